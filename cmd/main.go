@@ -1,30 +1,385 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
 	"language-learning-bot/cmd/telegram"
+	"language-learning-bot/pkg/anki"
+	"language-learning-bot/pkg/bot"
+	"language-learning-bot/pkg/config"
+	"language-learning-bot/pkg/eval"
+	"language-learning-bot/pkg/export"
+	"language-learning-bot/pkg/storage"
+	"language-learning-bot/pkg/wordlist"
 
+	"github.com/joho/godotenv"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 )
 
+// settings is populated by the root command before any subcommand runs
+var settings *config.Settings
+
 var rootCmd = &cobra.Command{
-	Use:   "langekko",
-	Short: "langekko is a language learning bot",
-	Run: func(cmd *cobra.Command, args []string) {
-		telegram.StartTelegramBot()
+	Use:          "langekko",
+	Short:        "langekko is a language learning bot",
+	SilenceUsage: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		err := godotenv.Load()
+		if err != nil && !os.IsNotExist(err) {
+			slog.Warn("Error loading .env file", "error", err)
+		}
+		settings, err = config.LoadSettings(cmd.Flags())
+		if err != nil {
+			return fmt.Errorf("invalid configuration:\n%w", err)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runTelegram()
 	},
 }
 
 var telegramCmd = &cobra.Command{
 	Use:   "telegram",
 	Short: "Run langekko as a Telegram bot",
-	Run: func(cmd *cobra.Command, args []string) {
-		telegram.StartTelegramBot()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runTelegram()
+	},
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration with secrets masked",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		content, err := settings.Masked().YAML()
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(cmd.OutOrStdout(), content)
+		return nil
+	},
+}
+
+var promptsCmd = &cobra.Command{
+	Use:   "prompts",
+	Short: "Work with prompt templates and tunings",
+}
+
+var promptsLintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Check prompt templates and tuning files for errors",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		issues := config.Lint(config.TemplatesFS(settings.Templates.OverrideDir))
+		for _, issue := range issues {
+			fmt.Fprintln(cmd.OutOrStdout(), issue)
+		}
+		if err := config.LintErrors(issues); err != nil {
+			return errors.New("prompt files have errors")
+		}
+		return nil
+	},
+}
+
+var evalCmd = &cobra.Command{
+	Use:   "eval",
+	Short: "Run the prompt evaluation suite against the OpenAI API",
+	Long: "Run every case of the suite for each combination of --model and --prompts " +
+		"and report which answers fail their assertions, to compare prompt versions or models.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if settings.OpenAI.APIToken == "" {
+			return errors.New("openai.api_token (OPENAI_API_TOKEN) is required")
+		}
+		suitePath, _ := cmd.Flags().GetString("suite")
+		models, _ := cmd.Flags().GetStringSlice("model")
+		promptDirs, _ := cmd.Flags().GetStringSlice("prompts")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+
+		suite, err := eval.LoadSuite(suitePath)
+		if err != nil {
+			return err
+		}
+		explicitModels := len(models) > 0
+		if !explicitModels {
+			models = []string{settings.OpenAI.ChatModel}
+		}
+		if len(promptDirs) == 0 {
+			promptDirs = []string{settings.Templates.OverrideDir}
+		}
+
+		var variants []eval.Variant
+		for _, promptDir := range promptDirs {
+			for _, model := range models {
+				variantSettings := *settings
+				variantSettings.OpenAI.ChatModel = model
+				variantSettings.Templates.OverrideDir = promptDir
+				variantConfig, err := config.LoadConfig(&variantSettings)
+				if err != nil {
+					return fmt.Errorf("loading prompts %q: %w", promptDir, err)
+				}
+				label := model
+				if promptDir != "" {
+					label += "@" + promptDir
+				}
+				variant := eval.Variant{Label: label, Config: variantConfig}
+				if explicitModels {
+					variant.Model = model
+				}
+				variants = append(variants, variant)
+			}
+		}
+
+		openaiClient := openai.NewClient(settings.OpenAI.APIToken)
+		results := eval.Run(cmd.Context(), openaiClient, suite, variants)
+		eval.WriteReport(cmd.OutOrStdout(), results, verbose)
+		if eval.Failed(results) {
+			return errors.New("some evaluation cases failed")
+		}
+		return nil
+	},
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the data of a user",
+}
+
+var exportAnkiCmd = &cobra.Command{
+	Use:   "anki",
+	Short: "Export the saved words of a user as an Anki deck (.apkg)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		userID, _ := cmd.Flags().GetInt("user")
+		language, _ := cmd.Flags().GetString("language")
+		withAudio, _ := cmd.Flags().GetBool("audio")
+		output, _ := cmd.Flags().GetString("output")
+
+		db, err := openExistingDatabase(cmd.Context(), false, "users", "vocabulary", "vocabulary_tags", "queries", "response_cache", "tts_cache")
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		if language == "" {
+			language, err = storage.GetUserLanguage(cmd.Context(), db, userID)
+			if err != nil {
+				return fmt.Errorf("getting the language of user %d: %w", userID, err)
+			}
+		}
+		deck, err := anki.VocabularyDeck(cmd.Context(), db, userID, language, withAudio)
+		if err != nil {
+			return err
+		}
+		if len(deck.Cards) == 0 {
+			return fmt.Errorf("user %d has no saved %s words", userID, language)
+		}
+
+		if output == "" {
+			output = fmt.Sprintf("langekko-%d-%s.apkg", userID, language)
+		}
+		file, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		if err := anki.Write(file, deck); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Exported %d cards to %s\n", len(deck.Cards), output)
+		return nil
 	},
 }
 
+// exportTables are the tables each kind of export reads
+var exportTables = map[string][]string{
+	"history":    {"queries"},
+	"vocabulary": {"vocabulary", "vocabulary_tags", "queries", "response_cache", "tts_cache"},
+	"stats":      {"exercises", "quizzes", "quiz_questions"},
+}
+
+// newExportTableCmd returns the command exporting the table of the kind
+func newExportTableCmd(kind string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   kind,
+		Short: fmt.Sprintf("Export the %s of a user as CSV or JSON", kind),
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			userID, _ := cmd.Flags().GetInt("user")
+			format, _ := cmd.Flags().GetString("format")
+			output, _ := cmd.Flags().GetString("output")
+
+			db, err := openExistingDatabase(cmd.Context(), false, exportTables[kind]...)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			table, err := export.Build(cmd.Context(), db, userID, kind)
+			if err != nil {
+				return err
+			}
+			if output == "" {
+				return export.Write(cmd.OutOrStdout(), table, format)
+			}
+			file, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			if err := export.Write(file, table, format); err != nil {
+				file.Close()
+				return err
+			}
+			return file.Close()
+		},
+	}
+	cmd.Flags().Int("user", 0, "Telegram user ID of the user to export")
+	cmd.Flags().String("format", "csv", "file format, csv or json")
+	cmd.Flags().String("output", "", "path of the file (default: standard output)")
+	cmd.MarkFlagRequired("user")
+	return cmd
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import data for a user",
+}
+
+var importWordsCmd = &cobra.Command{
+	Use:   "words <file>",
+	Short: "Import a CSV, TSV, plain text or JSON word list into the saved words of a user",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		userID, _ := cmd.Flags().GetInt("user")
+		language, _ := cmd.Flags().GetString("language")
+		translate, _ := cmd.Flags().GetBool("translate")
+
+		content, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		entries, err := wordlist.Parse(args[0], content)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", args[0], err)
+		}
+
+		var gptConfig *config.Config
+		var openaiClient *openai.Client
+		if translate {
+			if settings.OpenAI.APIToken == "" {
+				return errors.New("openai.api_token (OPENAI_API_TOKEN) is required to translate the words")
+			}
+			gptConfig, err = config.LoadConfig(settings)
+			if err != nil {
+				return err
+			}
+			openaiClient = openai.NewClient(settings.OpenAI.APIToken)
+		}
+
+		tables := []string{"users", "vocabulary", "vocabulary_tags", "queries"}
+		if translate {
+			tables = append(tables, "response_cache", "cached_response_levels", "structured_responses", "user_levels")
+		}
+		db, err := openExistingDatabase(cmd.Context(), true, tables...)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		if language == "" {
+			language, err = storage.GetUserLanguage(cmd.Context(), db, userID)
+			if err != nil {
+				return fmt.Errorf("getting the language of user %d: %w", userID, err)
+			}
+		}
+		result, err := bot.ImportWords(cmd.Context(), gptConfig, db, openaiClient, userID, language, entries, translate)
+		if err != nil {
+			return err
+		}
+		if len(result.Languages) > 0 {
+			language = strings.Join(result.Languages, " and ")
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Imported %s words: %s\n", language, result)
+		return nil
+	},
+}
+
+// openExistingDatabase opens the configured database without applying the
+// schema, so that the CLI neither migrates nor rewrites the database the bot
+// may be using. The database is opened read-only unless writable is set, and
+// the tables given must exist.
+func openExistingDatabase(ctx context.Context, writable bool, tables ...string) (*sql.DB, error) {
+	mode := "ro"
+	if writable {
+		mode = "rw"
+	}
+	path := settings.Database.SQLitePath
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=%s", path, mode))
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range tables {
+		var name string
+		err := db.QueryRowContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?;", table).Scan(&name)
+		if err == sql.ErrNoRows {
+			err = fmt.Errorf("database %s has no %s table, start the bot once to create or update its schema", path, table)
+		} else if err != nil {
+			err = fmt.Errorf("opening database %s: %w", path, err)
+		}
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+func runTelegram() error {
+	if err := settings.ValidateForTelegram(); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return telegram.StartTelegramBot(settings)
+}
+
 func Execute() {
-	rootCmd.AddCommand(telegramCmd)
-	rootCmd.Execute()
+	config.RegisterFlags(rootCmd.PersistentFlags())
+	configCmd.AddCommand(configShowCmd)
+	promptsCmd.AddCommand(promptsLintCmd)
+	evalCmd.Flags().String("suite", "evals/suite.yaml", "path to the evaluation suite")
+	evalCmd.Flags().StringSlice("model", nil, "model to evaluate, repeat to compare models (default: configured chat model)")
+	evalCmd.Flags().StringSlice("prompts", nil, "prompt override directory to evaluate, repeat to compare prompt versions (default: configured templates)")
+	evalCmd.Flags().Bool("verbose", false, "print the answers of passing cases too")
+	exportAnkiCmd.Flags().Int("user", 0, "Telegram user ID of the user to export")
+	exportAnkiCmd.Flags().String("language", "", "language of the words to export (default: the user's current language)")
+	exportAnkiCmd.Flags().Bool("audio", true, "include the cached pronunciation of the words")
+	exportAnkiCmd.Flags().String("output", "", "path of the .apkg file (default: langekko-<user>-<language>.apkg)")
+	exportAnkiCmd.MarkFlagRequired("user")
+	exportCmd.AddCommand(exportAnkiCmd)
+	for _, kind := range export.Kinds {
+		exportCmd.AddCommand(newExportTableCmd(kind))
+	}
+	importWordsCmd.Flags().Int("user", 0, "Telegram user ID of the user to import the words for")
+	importWordsCmd.Flags().String("language", "", "language of the words of a list without a language column (default: the user's current language)")
+	importWordsCmd.Flags().Bool("translate", false, "look up and cache the translation of every word")
+	importWordsCmd.MarkFlagRequired("user")
+	importCmd.AddCommand(importWordsCmd)
+	rootCmd.AddCommand(telegramCmd, configCmd, promptsCmd, evalCmd, exportCmd, importCmd)
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
 }
 
 func main() {
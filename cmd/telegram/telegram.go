@@ -3,34 +3,66 @@ package telegram
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	languagelearningbot "language-learning-bot"
 	"language-learning-bot/pkg/bot"
+	"language-learning-bot/pkg/config"
+	"language-learning-bot/pkg/health"
+	"language-learning-bot/pkg/logging"
+	"language-learning-bot/pkg/metrics"
 	"language-learning-bot/pkg/storage"
-	"log"
-	"os"
-	"strconv"
-	"strings"
+	"language-learning-bot/pkg/tracing"
+	"log/slog"
+	"net/http"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/joho/godotenv"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func StartTelegramBot() {
-	err := godotenv.Load()
+// StartTelegramBot runs the bot until polling stops. Errors are returned
+// rather than exiting, so that deferred shutdowns like flushing the traces
+// run before the process exits.
+func StartTelegramBot(settings *config.Settings) error {
+	err := logging.Setup(settings.Log.Level, settings.Log.Format)
 	if err != nil {
-		log.Printf("Error loading .env file: %v\n", err)
+		return fmt.Errorf("configuring logging: %w", err)
 	}
-	tgbot, err := tgbotapi.NewBotAPI(os.Getenv("TELEGRAM_TOKEN"))
+	shutdownTracing, err := tracing.Init(context.Background(), settings.Tracing.Enabled)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("configuring tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	tgbot, err := tgbotapi.NewBotAPI(settings.Telegram.Token)
+	if err != nil {
+		return fmt.Errorf("creating Telegram bot: %w", err)
 	}
 	tgbotConfig := tgbotapi.NewSetMyCommands(
 		tgbotapi.BotCommand{Command: "start", Description: "Configure the preferred language"},
 		tgbotapi.BotCommand{Command: "inflection", Description: "Give inflection of a given word"},
 		tgbotapi.BotCommand{Command: "translation", Description: "Provide translation of a phrase or a word"},
 		tgbotapi.BotCommand{Command: "examples", Description: "Provide 3-4 examples of a word or a phrase"},
+		tgbotapi.BotCommand{Command: "chat", Description: "Practice a conversation in a role-play scenario"},
+		tgbotapi.BotCommand{Command: "correct", Description: "Correct a text you wrote and explain the mistakes"},
+		tgbotapi.BotCommand{Command: "quiz", Description: "Take a multiple-choice quiz on the words you looked up"},
+		tgbotapi.BotCommand{Command: "drill", Description: "Practice the forms of verbs you looked up"},
+		tgbotapi.BotCommand{Command: "cloze", Description: "Fill in the gaps in example sentences of your words"},
+		tgbotapi.BotCommand{Command: "dictation", Description: "Write down sentences you hear"},
+		tgbotapi.BotCommand{Command: "words", Description: "List your saved words, optionally a #tag or a search"},
+		tgbotapi.BotCommand{Command: "save", Description: "Save the last looked up word or the given one, with #tags"},
+		tgbotapi.BotCommand{Command: "forget", Description: "Remove a word from your saved words"},
+		tgbotapi.BotCommand{Command: "tag", Description: "Add #tags to or remove -#tags from a saved word"},
+		tgbotapi.BotCommand{Command: "export_anki", Description: "Export your saved words as an Anki deck, \"text\" for no audio"},
+		tgbotapi.BotCommand{Command: "import", Description: "Import a CSV, TSV or JSON word list into your saved words"},
+		tgbotapi.BotCommand{Command: "export", Description: "Export your history, saved words or review stats as CSV or JSON"},
+		tgbotapi.BotCommand{Command: "word_of_day", Description: "Get a word of the day, optionally at a time HH:MM UTC, or off"},
+		tgbotapi.BotCommand{Command: "lang", Description: "Switch between, add or remove the languages you learn"},
+		tgbotapi.BotCommand{Command: "level", Description: "Take a placement test or set your CEFR level, e.g. B1"},
+		tgbotapi.BotCommand{Command: "weaknesses", Description: "Show the mistakes you make most often"},
+		tgbotapi.BotCommand{Command: "practice", Description: "Get exercises for your most frequent mistakes"},
 		tgbotapi.BotCommand{Command: "pronunciation", Description: "Pronounce a word or a phrase"},
 		tgbotapi.BotCommand{Command: "speech_speed", Description: "Set speech speed"},
 		tgbotapi.BotCommand{Command: "healthz", Description: "Check service health status"},
@@ -38,98 +70,177 @@ func StartTelegramBot() {
 
 	_, err = tgbot.Request(tgbotConfig)
 	if err != nil {
-		log.Fatal("Error setting commands:", err)
+		return fmt.Errorf("setting commands: %w", err)
 	}
 
-	openaiClient := openai.NewClient(os.Getenv("OPENAI_API_TOKEN"))
+	openaiClient := openai.NewClient(settings.OpenAI.APIToken)
 
-	db, err := sql.Open("sqlite3", os.Getenv("SQLITE_PATH"))
+	db, err := sql.Open("sqlite3", settings.Database.SQLitePath)
 	if err != nil {
-		log.Fatal("Error opening database:", err)
+		return fmt.Errorf("opening database: %w", err)
 	}
 	defer db.Close()
 
-	initDBSQL, err := os.ReadFile("scripts/init_db.sql")
+	_, err = db.Exec(languagelearningbot.InitDBSQL)
 	if err != nil {
-		log.Fatal("Error reading init_db.sql:", err)
+		return fmt.Errorf("executing init_db.sql: %w", err)
 	}
 
-	_, err = db.Exec(string(initDBSQL))
+	configStore, err := config.NewStore(settings)
 	if err != nil {
-		log.Fatal("Error executing init_db.sql:", err)
+		return fmt.Errorf("loading config: %w", err)
+	}
+	err = configStore.Watch(context.Background())
+	if err != nil {
+		return fmt.Errorf("watching templates: %w", err)
 	}
 
-	allowedUsers := []int64{}
-	allowedUsersStr := os.Getenv("ALLOWED_TELEGRAM_USER_IDS")
+	allowedUsers := settings.Telegram.AllowedUserIDs
 
-	for _, id := range strings.Split(allowedUsersStr, ",") {
-
-		allowedUser, err := strconv.ParseInt(id, 10, 64)
-		if err != nil {
-			log.Fatal(err)
-		}
-		allowedUsers = append(allowedUsers, allowedUser)
-	}
+	healthChecker := health.NewChecker(db, openaiClient, configStore)
+	StartHTTPServer(settings.HTTPAddress(), healthChecker)
 
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
-	updates := tgbot.GetUpdatesChan(u)
+	updates := PollUpdates(tgbot, u, healthChecker)
 
-	ScheduleQueriesRemoval(db)
+	ScheduleQueriesRemoval(db, settings.Cache)
+	ScheduleWordOfDay(tgbot, db, openaiClient, configStore, settings.WordOfDay)
 
-	log.Println("Running...")
+	slog.Info("Running...")
 
 	for update := range updates {
+		metrics.UpdatesTotal.WithLabelValues(updateType(update)).Inc()
 
 		go func(update tgbotapi.Update) {
+			metrics.GoroutinesInFlight.Inc()
+			defer metrics.GoroutinesInFlight.Dec()
+			ctx := logging.WithCorrelationID(context.Background(), logging.NewCorrelationID())
+			if from := update.SentFrom(); from != nil {
+				ctx = logging.WithUserID(ctx, from.ID)
+			}
+			ctx, span := tracing.Start(ctx, "telegram.update",
+				attribute.Int("update.id", update.UpdateID),
+				attribute.String("update.type", updateType(update)),
+			)
+			defer span.End()
+
 			defer func() {
 				if r := recover(); r != nil {
-					log.Println("Recovered in f", r)
+					slog.ErrorContext(ctx, "Recovered from panic in update handler", "panic", r)
 				}
 			}()
 
-			ctx := context.Background()
-
 			if !bot.IsAllowedUser(update, allowedUsers) {
-				log.Printf("User %d is not allowed to use bot", update.Message.From.ID)
+				slog.WarnContext(ctx, "User is not allowed to use bot")
 				return
 			}
+			// one config snapshot per update, so a reload never mixes prompts
+			gptConfig := configStore.Get()
 			if update.Message != nil {
 				if update.Message.IsCommand() {
-					err := bot.HandleCommand(ctx, tgbot, update.Message, db, openaiClient)
+					err := bot.HandleCommand(ctx, tgbot, update.Message, db, openaiClient, gptConfig)
 					if err != nil {
-						log.Printf("Error handling command: %v\n", err)
+						slog.ErrorContext(ctx, "Error handling command", "error", err)
 					}
 
 				} else {
-					bot.HandleMessage(ctx, tgbot, update.Message, openaiClient, db)
+					bot.HandleMessage(ctx, tgbot, update.Message, openaiClient, db, gptConfig)
 				}
 			} else if update.CallbackQuery != nil {
-				bot.HandleCallbackQuery(tgbot, openaiClient, update.CallbackQuery, db)
+				bot.HandleCallbackQuery(ctx, tgbot, openaiClient, update.CallbackQuery, db, gptConfig)
 			}
 		}(update)
 	}
+	return nil
 }
 
-func ScheduleQueriesRemoval(db *sql.DB) {
-	// check if CACHE_CLEAN_INTERVAL_HOURS is set, otherwise set default value to 24
-	cacheCleanIntervalHoursStr := os.Getenv("CACHE_CLEAN_INTERVAL_HOURS")
-	if cacheCleanIntervalHoursStr == "" {
-		cacheCleanIntervalHoursStr = "24"
-	}
-	cacheCleanIntervalHours, err := strconv.Atoi(cacheCleanIntervalHoursStr)
-	if err != nil {
-		log.Fatal(err)
+// PollUpdates long polls Telegram for updates like GetUpdatesChan, recording
+// a heartbeat after every successful poll, so that the heartbeat goes stale
+// when polling fails or hangs even if no updates are expected
+func PollUpdates(tgbot *tgbotapi.BotAPI, config tgbotapi.UpdateConfig, healthChecker *health.Checker) tgbotapi.UpdatesChannel {
+	updates := make(chan tgbotapi.Update, tgbot.Buffer)
+	go func() {
+		for {
+			polled, err := tgbot.GetUpdates(config)
+			if err != nil {
+				slog.Error("Error getting updates, retrying in 3 seconds", "error", err)
+				time.Sleep(3 * time.Second)
+				continue
+			}
+			healthChecker.Heartbeat()
+			for _, update := range polled {
+				if update.UpdateID >= config.Offset {
+					config.Offset = update.UpdateID + 1
+					updates <- update
+				}
+			}
+		}
+	}()
+	return updates
+}
+
+// updateType returns the metrics label for the kind of the given update
+func updateType(update tgbotapi.Update) string {
+	switch {
+	case update.Message != nil && update.Message.IsCommand():
+		return "command"
+	case update.Message != nil:
+		return "message"
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	default:
+		return "other"
 	}
+}
+
+// StartHTTPServer serves the /metrics, /healthz and /readyz endpoints on addr
+func StartHTTPServer(addr string, healthChecker *health.Checker) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", healthChecker.LivenessHandler())
+	mux.Handle("/readyz", healthChecker.ReadinessHandler())
+
+	go func() {
+		slog.Info("Serving HTTP", "addr", addr)
+		err := http.ListenAndServe(addr, mux)
+		if err != nil {
+			slog.Error("Error serving HTTP", "error", err)
+		}
+	}()
+}
+
+func ScheduleQueriesRemoval(db *sql.DB, cacheSettings config.CacheSettings) {
 	// schedule queries removal
-	ticker := time.NewTicker(time.Duration(cacheCleanIntervalHours) * time.Hour)
+	ticker := time.NewTicker(cacheSettings.CleanInterval)
 
-	defer ticker.Stop()
 	go func() {
+		defer ticker.Stop()
 		for range ticker.C {
-			err := storage.CleanOldCachedResponses(db)
+			err := storage.CleanOldCachedResponses(context.Background(), db, cacheSettings.TTL)
+			if err != nil {
+				slog.Error("Error cleaning old cached responses", "error", err)
+			}
+			err = storage.CleanOldCachedTTS(context.Background(), db, cacheSettings.TTL)
+			if err != nil {
+				slog.Error("Error cleaning old cached speech", "error", err)
+			}
+		}
+	}()
+}
+
+// ScheduleWordOfDay periodically sends the word of the day to the
+// subscribers whose delivery time has come
+func ScheduleWordOfDay(tgbot *tgbotapi.BotAPI, db *sql.DB, openaiClient *openai.Client, configStore *config.Store, wordOfDaySettings config.WordOfDaySettings) {
+	ticker := time.NewTicker(wordOfDaySettings.CheckInterval)
+
+	go func() {
+		defer ticker.Stop()
+		for now := range ticker.C {
+			ctx := logging.WithCorrelationID(context.Background(), logging.NewCorrelationID())
+			err := bot.SendDueWordsOfDay(ctx, tgbot, db, openaiClient, configStore.Get(), now)
 			if err != nil {
-				log.Println("Error cleaning old cached responses:", err)
+				slog.ErrorContext(ctx, "Error sending words of the day", "error", err)
 			}
 		}
 	}()
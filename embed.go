@@ -0,0 +1,24 @@
+// Package languagelearningbot embeds the default prompt templates and the
+// database schema so the binary does not depend on its working directory.
+package languagelearningbot
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed templates
+var templates embed.FS
+
+//go:embed scripts/init_db.sql
+var InitDBSQL string
+
+// Templates returns the embedded templates directory
+func Templates() fs.FS {
+	sub, err := fs.Sub(templates, "templates")
+	if err != nil {
+		// fs.Sub only fails for invalid paths, and "templates" is valid
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,310 @@
+// Package anki writes flash cards as Anki package (.apkg) files: a zip
+// archive of an Anki collection database and the media it references
+package anki
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Card is a note with a front and a back, both HTML
+type Card struct {
+	// ID identifies the card across exports, so that importing a deck again
+	// updates the cards instead of duplicating them
+	ID    string
+	Front string
+	Back  string
+	Tags  []string
+	// Audio is an MP3 played on the back of the card, if set
+	Audio []byte
+}
+
+type Deck struct {
+	Name  string
+	Cards []Card
+}
+
+// schema is the collection schema of Anki 2.1 (version 11)
+const schema = `
+CREATE TABLE col (
+    id integer primary key, crt integer not null, mod integer not null, scm integer not null,
+    ver integer not null, dty integer not null, usn integer not null, ls integer not null,
+    conf text not null, models text not null, decks text not null, dconf text not null, tags text not null
+);
+CREATE TABLE notes (
+    id integer primary key, guid text not null, mid integer not null, mod integer not null,
+    usn integer not null, tags text not null, flds text not null, sfld integer not null,
+    csum integer not null, flags integer not null, data text not null
+);
+CREATE TABLE cards (
+    id integer primary key, nid integer not null, did integer not null, ord integer not null,
+    mod integer not null, usn integer not null, type integer not null, queue integer not null,
+    due integer not null, ivl integer not null, factor integer not null, reps integer not null,
+    lapses integer not null, left integer not null, odue integer not null, odid integer not null,
+    flags integer not null, data text not null
+);
+CREATE TABLE revlog (
+    id integer primary key, cid integer not null, usn integer not null, ease integer not null,
+    ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null, type integer not null
+);
+CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null);
+CREATE INDEX ix_notes_usn ON notes (usn);
+CREATE INDEX ix_cards_usn ON cards (usn);
+CREATE INDEX ix_revlog_usn ON revlog (usn);
+CREATE INDEX ix_cards_nid ON cards (nid);
+CREATE INDEX ix_cards_sched ON cards (did, queue, due);
+CREATE INDEX ix_revlog_cid ON revlog (cid);
+CREATE INDEX ix_notes_csum ON notes (csum);
+`
+
+const (
+	// fieldSeparator separates the fields of a note
+	fieldSeparator = "\x1f"
+	// defaultDeckID is the ID of the Default deck every collection has
+	defaultDeckID = 1
+)
+
+// Write writes the deck as an .apkg file to w
+func Write(w io.Writer, deck Deck) error {
+	dir, err := os.MkdirTemp("", "anki")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	collectionPath := filepath.Join(dir, "collection.anki2")
+	media, err := writeCollection(collectionPath, deck, time.Now())
+	if err != nil {
+		return fmt.Errorf("writing collection: %w", err)
+	}
+
+	archive := zip.NewWriter(w)
+	collection, err := os.ReadFile(collectionPath)
+	if err != nil {
+		return err
+	}
+	if err := addFile(archive, "collection.anki2", collection); err != nil {
+		return err
+	}
+
+	// media files are stored by number with a map to their names
+	mediaMap := make(map[string]string, len(media))
+	for i, file := range media {
+		mediaMap[strconv.Itoa(i)] = file.name
+		if err := addFile(archive, strconv.Itoa(i), file.content); err != nil {
+			return err
+		}
+	}
+	mediaJSON, err := json.Marshal(mediaMap)
+	if err != nil {
+		return err
+	}
+	if err := addFile(archive, "media", mediaJSON); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func addFile(archive *zip.Writer, name string, content []byte) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	return err
+}
+
+type mediaFile struct {
+	name    string
+	content []byte
+}
+
+// writeCollection creates the collection database of the deck at path and
+// returns the media files its cards reference
+func writeCollection(path string, deck Deck, now time.Time) ([]mediaFile, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(schema); err != nil {
+		return nil, err
+	}
+
+	// IDs are millisecond timestamps in Anki; the model and deck IDs are
+	// derived from the deck name so that they stay the same across exports
+	modelID := stableID(deck.Name + " model")
+	deckID := stableID(deck.Name)
+	models, decks, dconf, conf := collectionJSON(deck.Name, modelID, deckID, now)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO col VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}');`,
+		now.Unix(), now.UnixMilli(), now.UnixMilli(), conf, models, decks, dconf)
+	if err != nil {
+		return nil, err
+	}
+
+	var media []mediaFile
+	for i, card := range deck.Cards {
+		back := card.Back
+		if len(card.Audio) > 0 {
+			name := fmt.Sprintf("langekko-%s.mp3", guid(card.ID))
+			media = append(media, mediaFile{name: name, content: card.Audio})
+			back += fmt.Sprintf("<br>[sound:%s]", name)
+		}
+
+		noteID := now.UnixMilli() + int64(i)
+		sortField := stripHTML(card.Front)
+		tags := ""
+		if len(card.Tags) > 0 {
+			tags = " " + strings.Join(card.Tags, " ") + " "
+		}
+		_, err := tx.Exec(`INSERT INTO notes VALUES (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '');`,
+			noteID, guid(card.ID), modelID, now.Unix(), tags, card.Front+fieldSeparator+back, sortField, checksum(sortField))
+		if err != nil {
+			return nil, err
+		}
+		// new cards are due in the order of the deck
+		_, err = tx.Exec(`INSERT INTO cards VALUES (?, ?, ?, 0, ?, -1, 0, 0, ?, 0, 0, 0, 0, 0, 0, 0, 0, '');`,
+			noteID, noteID, deckID, now.Unix(), i+1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return media, tx.Commit()
+}
+
+// collectionJSON returns the note types, decks, deck options and settings of
+// a collection with a basic front and back note type and the deck
+func collectionJSON(deckName string, modelID, deckID int64, now time.Time) (models, decks, dconf, conf string) {
+	field := func(name string, ord int) map[string]any {
+		return map[string]any{"name": name, "ord": ord, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []any{}}
+	}
+	model := map[string]any{
+		"id":    modelID,
+		"name":  "langekko",
+		"type":  0,
+		"mod":   now.Unix(),
+		"usn":   -1,
+		"sortf": 0,
+		"did":   deckID,
+		"tmpls": []any{map[string]any{
+			"name":  "Card 1",
+			"ord":   0,
+			"qfmt":  "{{Front}}",
+			"afmt":  "{{FrontSide}}<hr id=answer>{{Back}}",
+			"did":   nil,
+			"bqfmt": "",
+			"bafmt": "",
+		}},
+		"flds":      []any{field("Front", 0), field("Back", 1)},
+		"css":       ".card { font-family: arial; font-size: 20px; text-align: center; color: black; background-color: white; }",
+		"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+		"latexPost": "\\end{document}",
+		"tags":      []any{},
+		"vers":      []any{},
+		"req":       []any{[]any{0, "all", []any{0}}},
+	}
+	deck := func(id int64, name string) map[string]any {
+		return map[string]any{
+			"id": id, "name": name, "desc": "", "mod": now.Unix(), "usn": -1, "collapsed": false,
+			"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+			"dyn": 0, "conf": 1, "extendNew": 10, "extendRev": 50,
+		}
+	}
+	options := map[string]any{
+		"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60, "autoplay": true, "timer": 0, "replayq": true, "dyn": false,
+		"new": map[string]any{
+			"bury": true, "delays": []int{1, 10}, "initialFactor": 2500, "ints": []int{1, 4, 7},
+			"order": 1, "perDay": 20, "separate": true,
+		},
+		"rev": map[string]any{
+			"bury": true, "ease4": 1.3, "fuzz": 0.05, "ivlFct": 1, "maxIvl": 36500, "minSpace": 1, "perDay": 100,
+		},
+		"lapse": map[string]any{
+			"delays": []int{10}, "leechAction": 0, "leechFails": 8, "minInt": 1, "mult": 0,
+		},
+	}
+	settings := map[string]any{
+		"nextPos": 1, "estTimes": true, "activeDecks": []int64{defaultDeckID}, "sortType": "noteFld", "timeLim": 0,
+		"sortBackwards": false, "addToCur": true, "curDeck": defaultDeckID, "newBury": true, "newSpread": 0,
+		"dueCounts": true, "curModel": strconv.FormatInt(modelID, 10), "collapseTime": 1200,
+	}
+
+	models = mustJSON(map[string]any{strconv.FormatInt(modelID, 10): model})
+	decks = mustJSON(map[string]any{
+		strconv.Itoa(defaultDeckID):   deck(defaultDeckID, "Default"),
+		strconv.FormatInt(deckID, 10): deck(deckID, deckName),
+	})
+	dconf = mustJSON(map[string]any{"1": options})
+	conf = mustJSON(settings)
+	return models, decks, dconf, conf
+}
+
+func mustJSON(v any) string {
+	content, err := json.Marshal(v)
+	if err != nil {
+		// the values are built above from maps of plain values
+		panic(err)
+	}
+	return string(content)
+}
+
+// stableID derives a positive ID in the range of Anki's millisecond IDs from s
+func stableID(s string) int64 {
+	sum := sha1.Sum([]byte(s))
+	var id int64
+	for _, b := range sum[:5] {
+		id = id<<8 | int64(b)
+	}
+	return 1<<40 + id
+}
+
+// guid returns the globally unique ID of the note of a card
+func guid(id string) string {
+	sum := sha1.Sum([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// checksum is the first 8 hex digits of the SHA-1 of the sort field as a number
+func checksum(field string) int64 {
+	sum := sha1.Sum([]byte(field))
+	value, _ := strconv.ParseInt(hex.EncodeToString(sum[:4]), 16, 64)
+	return value
+}
+
+// stripHTML returns the text of an HTML field for sorting and checksums
+func stripHTML(field string) string {
+	var b strings.Builder
+	inTag := false
+	for _, r := range field {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>':
+			inTag = false
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return html.UnescapeString(b.String())
+}
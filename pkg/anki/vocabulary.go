@@ -0,0 +1,47 @@
+package anki
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"strings"
+
+	storage "language-learning-bot/pkg/storage"
+)
+
+// VocabularyDeck builds a deck with a card per saved word of the user in the
+// language: the word on the front, its cached translation and examples on
+// the back and, if withAudio is set, its cached pronunciation
+func VocabularyDeck(ctx context.Context, db *sql.DB, userID int, language string, withAudio bool) (Deck, error) {
+	words, err := storage.GetVocabularyExport(ctx, db, userID, language)
+	if err != nil {
+		return Deck{}, err
+	}
+
+	deck := Deck{Name: "langekko::" + language}
+	for _, word := range words {
+		var back []string
+		for _, response := range []string{word.Translation, word.Examples} {
+			if response = strings.TrimSpace(response); response != "" {
+				back = append(back, textToHTML(response))
+			}
+		}
+		card := Card{
+			ID:    fmt.Sprintf("%d/%s/%s", userID, language, strings.ToLower(word.Word)),
+			Front: html.EscapeString(word.Word),
+			Back:  strings.Join(back, "<br><br>"),
+			Tags:  word.Tags,
+		}
+		if withAudio {
+			card.Audio = word.Audio
+		}
+		deck.Cards = append(deck.Cards, card)
+	}
+	return deck, nil
+}
+
+// textToHTML escapes plain text and keeps its line breaks
+func textToHTML(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+}
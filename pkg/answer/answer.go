@@ -0,0 +1,123 @@
+// Package answer holds the structured answers requested from the model and
+// renders them as Telegram messages
+package answer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// SchemaName is the name the schema is sent to the model with
+const SchemaName = "word_answer"
+
+// Example is a sentence in the target language with its English translation
+type Example struct {
+	Text        string `json:"text" description:"Example sentence in the target language"`
+	Translation string `json:"translation" description:"English translation of the example sentence"`
+}
+
+// Form is an inflected form of the headword, e.g. a case or a conjugation
+type Form struct {
+	Label string `json:"label" description:"Grammatical category of the form, e.g. 'present, 1st person singular' or 'genitive plural'"`
+	Value string `json:"value" description:"The form in the target language"`
+}
+
+// Answer is the structured answer to a word, phrase or sentence
+type Answer struct {
+	Headword     string    `json:"headword" description:"The word or phrase in the target language in dictionary form, or the whole sentence in the target language"`
+	PartOfSpeech string    `json:"part_of_speech" description:"Part of speech of the headword, e.g. noun or verb. Empty for phrases and sentences"`
+	Gender       string    `json:"gender" description:"Grammatical gender or article of a noun, e.g. 'het' or 'masculine'. Empty otherwise"`
+	Translation  string    `json:"translation" description:"English translation of the headword"`
+	Senses       []string  `json:"senses" description:"The most common meanings in English when the headword has more than one, otherwise empty"`
+	Examples     []Example `json:"examples" description:"Example sentences using the headword"`
+	Forms        []Form    `json:"forms" description:"Inflected forms of the headword when inflection is requested, otherwise empty"`
+}
+
+// Schema is the JSON schema of Answer the model has to follow
+var Schema = mustGenerateSchema(Answer{})
+
+func mustGenerateSchema(v any) *jsonschema.Definition {
+	schema, err := jsonschema.GenerateSchemaForType(v)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// Parse decodes a structured answer returned by the model
+func Parse(content string) (*Answer, error) {
+	var answer Answer
+	if err := json.Unmarshal([]byte(content), &answer); err != nil {
+		return nil, fmt.Errorf("parsing structured answer: %w", err)
+	}
+	if answer.Headword == "" {
+		return nil, fmt.Errorf("structured answer has no headword")
+	}
+	return &answer, nil
+}
+
+// JSON encodes the answer for storage
+func (a *Answer) JSON() (string, error) {
+	content, err := json.Marshal(a)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// ExampleTexts returns the target language text of every example
+func (a *Answer) ExampleTexts() []string {
+	texts := make([]string, 0, len(a.Examples))
+	for _, example := range a.Examples {
+		texts = append(texts, example.Text)
+	}
+	return texts
+}
+
+// Render formats the answer as a plain text Telegram message. Examples are
+// numbered so they can be picked for pronunciation.
+func (a *Answer) Render() string {
+	var b strings.Builder
+
+	b.WriteString(a.Headword)
+	var grammar []string
+	if a.PartOfSpeech != "" {
+		grammar = append(grammar, a.PartOfSpeech)
+	}
+	if a.Gender != "" {
+		grammar = append(grammar, a.Gender)
+	}
+	if len(grammar) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(grammar, ", "))
+	}
+	if a.Translation != "" && a.Translation != a.Headword {
+		fmt.Fprintf(&b, " — %s", a.Translation)
+	}
+	b.WriteString("\n")
+
+	if len(a.Senses) > 0 {
+		b.WriteString("\nMeanings:\n")
+		for _, sense := range a.Senses {
+			fmt.Fprintf(&b, "• %s\n", sense)
+		}
+	}
+	if len(a.Forms) > 0 {
+		b.WriteString("\nForms:\n")
+		for _, form := range a.Forms {
+			fmt.Fprintf(&b, "%s: %s\n", form.Label, form.Value)
+		}
+	}
+	if len(a.Examples) > 0 {
+		b.WriteString("\nExamples:\n")
+		for i, example := range a.Examples {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, example.Text)
+			if example.Translation != "" {
+				fmt.Fprintf(&b, "   %s\n", example.Translation)
+			}
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,48 @@
+package answer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ChatSchemaName is the name the chat schema is sent to the model with
+const ChatSchemaName = "chat_reply"
+
+// ChatReply is the answer of the conversation partner to a chat message
+type ChatReply struct {
+	Reply       string       `json:"reply" description:"The reply in the target language, staying in the role of the scenario"`
+	Corrections []Correction `json:"corrections" description:"Mistakes in the learner's last message, empty if there are none"`
+}
+
+// ChatSchema is the JSON schema of ChatReply the model has to follow
+var ChatSchema = withCategories(mustGenerateSchema(ChatReply{}))
+
+// ParseChatReply decodes a structured chat reply returned by the model
+func ParseChatReply(content string) (*ChatReply, error) {
+	var reply ChatReply
+	if err := json.Unmarshal([]byte(content), &reply); err != nil {
+		return nil, fmt.Errorf("parsing chat reply: %w", err)
+	}
+	if reply.Reply == "" {
+		return nil, fmt.Errorf("chat reply is empty")
+	}
+	return &reply, nil
+}
+
+// Render formats the reply with the corrections below it
+func (r *ChatReply) Render() string {
+	var b strings.Builder
+	b.WriteString(r.Reply)
+	if len(r.Corrections) > 0 {
+		b.WriteString("\n\n✏️ Corrections:\n")
+		for _, correction := range r.Corrections {
+			fmt.Fprintf(&b, "• %s → %s", correction.Original, correction.Corrected)
+			if correction.Explanation != "" {
+				fmt.Fprintf(&b, " — %s", correction.Explanation)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,64 @@
+package answer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// CorrectionSchemaName is the name the correction schema is sent to the model with
+const CorrectionSchemaName = "text_correction"
+
+// Categories are the kinds of mistakes corrections are grouped by
+var Categories = []string{
+	"gender",
+	"article",
+	"word_order",
+	"conjugation",
+	"tense",
+	"agreement",
+	"case",
+	"preposition",
+	"spelling",
+	"word_choice",
+	"other",
+}
+
+// Correction is a mistake in the learner's text with its fix
+type Correction struct {
+	Original    string `json:"original" description:"The wrong fragment of the learner's text"`
+	Corrected   string `json:"corrected" description:"The corrected fragment in the target language"`
+	Category    string `json:"category" description:"The kind of mistake"`
+	Explanation string `json:"explanation" description:"Short explanation of the mistake in English"`
+}
+
+// CorrectionResult is the corrected version of a text written by the learner
+type CorrectionResult struct {
+	Corrected   string       `json:"corrected" description:"The whole text with every mistake fixed, otherwise unchanged"`
+	Corrections []Correction `json:"corrections" description:"Every mistake that was fixed, empty if the text is correct"`
+}
+
+// CorrectionSchema is the JSON schema of CorrectionResult the model has to follow
+var CorrectionSchema = withCategories(mustGenerateSchema(CorrectionResult{}))
+
+// withCategories restricts the category of the corrections in the schema to Categories
+func withCategories(schema *jsonschema.Definition) *jsonschema.Definition {
+	items := schema.Properties["corrections"].Items
+	category := items.Properties["category"]
+	category.Enum = Categories
+	items.Properties["category"] = category
+	return schema
+}
+
+// ParseCorrection decodes a structured correction returned by the model
+func ParseCorrection(content string) (*CorrectionResult, error) {
+	var result CorrectionResult
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return nil, fmt.Errorf("parsing correction: %w", err)
+	}
+	if result.Corrected == "" {
+		return nil, fmt.Errorf("correction has no corrected text")
+	}
+	return &result, nil
+}
@@ -0,0 +1,31 @@
+package answer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DictationSchemaName is the name the dictation schema is sent to the model with
+const DictationSchemaName = "dictation_sentence"
+
+// Dictation is a sentence to read out to the learner
+type Dictation struct {
+	Sentence    string `json:"sentence" description:"The sentence in the target language, written out as it is spoken"`
+	Translation string `json:"translation" description:"English translation of the sentence"`
+}
+
+// DictationSchema is the JSON schema of Dictation the model has to follow
+var DictationSchema = mustGenerateSchema(Dictation{})
+
+// ParseDictation decodes a structured dictation sentence returned by the model
+func ParseDictation(content string) (*Dictation, error) {
+	var d Dictation
+	if err := json.Unmarshal([]byte(content), &d); err != nil {
+		return nil, fmt.Errorf("parsing dictation: %w", err)
+	}
+	if strings.TrimSpace(d.Sentence) == "" {
+		return nil, fmt.Errorf("no sentence in the answer")
+	}
+	return &d, nil
+}
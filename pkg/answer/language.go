@@ -0,0 +1,31 @@
+package answer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DetectedLanguageSchemaName is the name the language detection schema is sent to the model with
+const DetectedLanguageSchemaName = "detected_language"
+
+// DetectedLanguage is the language a text is written in
+type DetectedLanguage struct {
+	Language string `json:"language" description:"The name of the language in English, one of the listed languages or English"`
+}
+
+// DetectedLanguageSchema is the JSON schema of DetectedLanguage the model has to follow
+var DetectedLanguageSchema = mustGenerateSchema(DetectedLanguage{})
+
+// ParseDetectedLanguage decodes the structured language returned by the model
+func ParseDetectedLanguage(content string) (*DetectedLanguage, error) {
+	var l DetectedLanguage
+	if err := json.Unmarshal([]byte(content), &l); err != nil {
+		return nil, fmt.Errorf("parsing detected language: %w", err)
+	}
+	l.Language = strings.TrimSpace(l.Language)
+	if l.Language == "" {
+		return nil, fmt.Errorf("no language in the answer")
+	}
+	return &l, nil
+}
@@ -0,0 +1,44 @@
+package answer
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PlacementSchemaName is the name the placement question schema is sent to the model with
+const PlacementSchemaName = "placement_question"
+
+// PlacementQuestion is a question of the placement test, answered by picking
+// one of the options or, if there are none, by typing a short answer
+type PlacementQuestion struct {
+	Question     string   `json:"question" description:"The question or the sentence with a gap written as ___, with the instruction in English"`
+	Options      []string `json:"options" description:"Four answer options for a multiple-choice question, empty for a short answer question"`
+	Answer       string   `json:"answer" description:"The correct answer, one of the options for a multiple-choice question"`
+	Alternatives []string `json:"alternatives" description:"Other correct answers to a short answer question, if any"`
+	Explanation  string   `json:"explanation" description:"One short sentence in English explaining the correct answer"`
+}
+
+// PlacementSchema is the JSON schema of PlacementQuestion the model has to follow
+var PlacementSchema = mustGenerateSchema(PlacementQuestion{})
+
+// ParsePlacementQuestion decodes a structured placement question returned by
+// the model and checks that the answer is one of the options, if it has any
+func ParsePlacementQuestion(content string) (*PlacementQuestion, error) {
+	var q PlacementQuestion
+	if err := json.Unmarshal([]byte(content), &q); err != nil {
+		return nil, fmt.Errorf("parsing placement question: %w", err)
+	}
+	q.Question, q.Answer = strings.TrimSpace(q.Question), strings.TrimSpace(q.Answer)
+	if q.Question == "" || q.Answer == "" {
+		return nil, fmt.Errorf("no question or answer in the answer")
+	}
+	for i, option := range q.Options {
+		q.Options[i] = strings.TrimSpace(option)
+	}
+	if len(q.Options) > 0 && !slices.Contains(q.Options, q.Answer) {
+		return nil, fmt.Errorf("the answer %q is not one of the options", q.Answer)
+	}
+	return &q, nil
+}
@@ -0,0 +1,38 @@
+package answer
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PracticeSchemaName is the name the practice schema is sent to the model with
+const PracticeSchemaName = "practice_exercises"
+
+// Exercise is a short task practicing a kind of mistake
+type Exercise struct {
+	Category    string `json:"category" description:"The kind of mistake the exercise practices"`
+	Instruction string `json:"instruction" description:"What to do, in English"`
+	Question    string `json:"question" description:"The task in the target language, with ___ for a gap if there is one"`
+	Answer      string `json:"answer" description:"The correct answer in the target language"`
+	Explanation string `json:"explanation" description:"Short explanation of the answer in English"`
+}
+
+// PracticeSet is a set of exercises generated for a learner
+type PracticeSet struct {
+	Exercises []Exercise `json:"exercises" description:"The exercises, easiest first"`
+}
+
+// PracticeSchema is the JSON schema of PracticeSet the model has to follow
+var PracticeSchema = mustGenerateSchema(PracticeSet{})
+
+// ParsePracticeSet decodes structured exercises returned by the model
+func ParsePracticeSet(content string) (*PracticeSet, error) {
+	var set PracticeSet
+	if err := json.Unmarshal([]byte(content), &set); err != nil {
+		return nil, fmt.Errorf("parsing exercises: %w", err)
+	}
+	if len(set.Exercises) == 0 {
+		return nil, fmt.Errorf("no exercises in the answer")
+	}
+	return &set, nil
+}
@@ -0,0 +1,31 @@
+package answer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// WordOfDaySchemaName is the name the word of the day schema is sent to the model with
+const WordOfDaySchemaName = "word_of_day"
+
+// WordOfDay is the word picked for the day
+type WordOfDay struct {
+	Word string `json:"word" description:"The word in the target language, in its dictionary form"`
+}
+
+// WordOfDaySchema is the JSON schema of WordOfDay the model has to follow
+var WordOfDaySchema = mustGenerateSchema(WordOfDay{})
+
+// ParseWordOfDay decodes the structured word of the day returned by the model
+func ParseWordOfDay(content string) (*WordOfDay, error) {
+	var w WordOfDay
+	if err := json.Unmarshal([]byte(content), &w); err != nil {
+		return nil, fmt.Errorf("parsing word of the day: %w", err)
+	}
+	w.Word = strings.TrimSpace(w.Word)
+	if w.Word == "" {
+		return nil, fmt.Errorf("no word in the answer")
+	}
+	return &w, nil
+}
@@ -0,0 +1,205 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"language-learning-bot/pkg/config"
+	storage "language-learning-bot/pkg/storage"
+	"language-learning-bot/pkg/wordlist"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// batchConcurrency is how many words of a list are looked up at once
+	batchConcurrency = 4
+	// batchMaxWords is the most words looked up from one document
+	batchMaxWords = 200
+	// batchProgressInterval is how often the status message is edited, to
+	// stay below the rate limits of Telegram
+	batchProgressInterval = 3 * time.Second
+)
+
+// BatchResult is the response to a word of a list, or the error looking it up
+type BatchResult struct {
+	Word     string
+	Response string
+	Err      error
+}
+
+// LookupWords looks up the words like single messages of the help type, a few
+// at a time, and returns the results in the order of the words. progress is
+// called with the number of words looked up so far after each word.
+func LookupWords(ctx context.Context, gptConfig *config.Config, db *sql.DB, openaiClient *openai.Client, userID int, language, helpType string, words []string, progress func(done int)) []BatchResult {
+	results := make([]BatchResult, len(words))
+	slots := make(chan struct{}, batchConcurrency)
+	var mu sync.Mutex
+	done := 0
+
+	var wg sync.WaitGroup
+	for i, word := range words {
+		wg.Add(1)
+		go func(i int, word string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			response, err := ProcessQuery(ctx, gptConfig, helpType, language, word, db, userID, openaiClient)
+			if err != nil {
+				slog.WarnContext(ctx, "Error looking up word of list", "error", err)
+			}
+			results[i] = BatchResult{Word: word, Response: response, Err: err}
+
+			mu.Lock()
+			done++
+			progress(done)
+			mu.Unlock()
+		}(i, word)
+	}
+	wg.Wait()
+	return results
+}
+
+// WriteBatchMarkdown writes the results as a Markdown document with a section
+// per word
+func WriteBatchMarkdown(results []BatchResult, language, helpType string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s %s\n", language, helpType)
+	for _, result := range results {
+		fmt.Fprintf(&b, "\n## %s\n\n", result.Word)
+		if result.Err != nil {
+			b.WriteString("_Could not be looked up._\n")
+			continue
+		}
+		b.WriteString(strings.TrimSpace(result.Response) + "\n")
+	}
+	return b.Bytes()
+}
+
+// WriteBatchCSV writes the results as CSV with a word and a response column
+func WriteBatchCSV(results []BatchResult) ([]byte, error) {
+	var b bytes.Buffer
+	writer := csv.NewWriter(&b)
+	if err := writer.Write([]string{"word", "response", "error"}); err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		errText := ""
+		if result.Err != nil {
+			errText = "could not be looked up"
+		}
+		if err := writer.Write([]string{result.Word, strings.TrimSpace(result.Response), errText}); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return b.Bytes(), writer.Error()
+}
+
+// lookupDocument looks up every word of the document in the help type of the
+// user and replies with a document of the responses, in CSV if the caption
+// asks for it and Markdown otherwise
+func lookupDocument(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, openaiClient *openai.Client, db *sql.DB, gptConfig *config.Config, asCSV bool) error {
+	userID := int(message.From.ID)
+	language, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
+		return err
+	}
+	helpType, err := GetUserHelpType(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+	switch helpType {
+	case "examples", "translation", "inflection":
+	default:
+		text := "Send a list of words in examples, translation or inflection mode to look them all up, or with the caption /import to save them to your words."
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+		return err
+	}
+
+	content, err := downloadDocument(ctx, bot, message.Document)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error downloading document", "error", err)
+		_, sendErr := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Could not read the file: %s", err)))
+		return sendErr
+	}
+	entries, err := wordlist.Parse(message.Document.FileName, content)
+	if err != nil {
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Could not read the word list: %s", err)))
+		return err
+	}
+	if len(entries) == 0 {
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, "The file has no words."))
+		return err
+	}
+	if len(entries) > batchMaxWords {
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("The file has %d words, please send at most %d at a time.", len(entries), batchMaxWords)))
+		return err
+	}
+	words := make([]string, len(entries))
+	for i, entry := range entries {
+		words[i] = entry.Word
+	}
+
+	status, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Looking up %d words: 0/%d", len(words), len(words))))
+	if err != nil {
+		slog.ErrorContext(ctx, "Error sending status message", "error", err)
+		return err
+	}
+	lastUpdate := time.Now()
+	results := LookupWords(ctx, gptConfig, db, openaiClient, userID, language, helpType, words, func(done int) {
+		if done < len(words) && time.Since(lastUpdate) < batchProgressInterval {
+			return
+		}
+		lastUpdate = time.Now()
+		edit := tgbotapi.NewEditMessageText(message.Chat.ID, status.MessageID, fmt.Sprintf("Looking up %d words: %d/%d", len(words), done, len(words)))
+		if _, err := request(ctx, bot, edit); err != nil {
+			slog.WarnContext(ctx, "Error updating status message", "error", err)
+		}
+	})
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed == len(results) {
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, "Sorry, none of the words could be looked up. Please try again later."))
+		return err
+	}
+
+	name := fmt.Sprintf("langekko-%s-%s.md", language, helpType)
+	var document []byte
+	if asCSV {
+		name = fmt.Sprintf("langekko-%s-%s.csv", language, helpType)
+		if document, err = WriteBatchCSV(results); err != nil {
+			slog.ErrorContext(ctx, "Error writing batch results", "error", err)
+			return err
+		}
+	} else {
+		document = WriteBatchMarkdown(results, language, helpType)
+	}
+
+	reply := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{Name: name, Bytes: document})
+	reply.Caption = fmt.Sprintf("%s of %d %s words.", strings.ToUpper(helpType[:1])+helpType[1:], len(results)-failed, language)
+	if failed > 0 {
+		reply.Caption += fmt.Sprintf(" %d could not be looked up.", failed)
+	}
+	reply.ReplyToMessageID = message.MessageID
+	if _, err := send(ctx, bot, reply); err != nil {
+		slog.ErrorContext(ctx, "Error sending batch results", "error", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"language-learning-bot/pkg/answer"
+	"language-learning-bot/pkg/config"
+	"language-learning-bot/pkg/metrics"
+	openai_api "language-learning-bot/pkg/openai"
+	storage "language-learning-bot/pkg/storage"
+	"language-learning-bot/pkg/tracing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// chatDifficulties are the levels the conversation adapts between, from easiest
+var chatDifficulties = []string{"beginner (A1-A2)", "intermediate (B1-B2)", "advanced (C1-C2)"}
+
+const (
+	// chatLevelUpTurns messages without mistakes raise the difficulty
+	chatLevelUpTurns = 4
+	// chatLevelDownTurns messages with mistakes lower the difficulty
+	chatLevelDownTurns = 3
+	// chatOpening is sent in place of a user message to have the partner open the conversation
+	chatOpening = "(I joined the conversation. Open it in your role.)"
+)
+
+func handleChatCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, scenarios []config.ChatScenario) error {
+	err := storage.UpdateUserHelpType(ctx, db, int(message.From.ID), "chat")
+	if err != nil {
+		slog.ErrorContext(ctx, "Error updating user help_type", "error", err)
+		return err
+	}
+	return sendChatScenarioSelection(ctx, bot, message.Chat.ID, scenarios)
+}
+
+func sendChatScenarioSelection(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, scenarios []config.ChatScenario) error {
+	msg := tgbotapi.NewMessage(chatID, "Let's have a conversation! Please choose a scenario:")
+	msg.ReplyMarkup = chatScenarioInlineKeyboard(scenarios)
+	_, err := send(ctx, bot, msg)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error sending chat scenario selection", "error", err)
+		return err
+	}
+	return nil
+}
+
+// chatScenarioInlineKeyboard returns an inline keyboard with a row per scenario
+func chatScenarioInlineKeyboard(scenarios []config.ChatScenario) tgbotapi.InlineKeyboardMarkup {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup()
+	for _, scenario := range scenarios {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(scenario.Label, "chat_scenario:"+scenario.ID),
+		))
+	}
+	return keyboard
+}
+
+// findChatScenario returns the configured scenario with the ID, or the first
+// scenario if it was removed from the configuration
+func findChatScenario(scenarios []config.ChatScenario, id string) config.ChatScenario {
+	for _, scenario := range scenarios {
+		if scenario.ID == id {
+			return scenario
+		}
+	}
+	return scenarios[0]
+}
+
+// handleChatScenarioCallback starts a conversation in the picked scenario and
+// lets the partner open it
+func handleChatScenarioCallback(ctx context.Context, bot *tgbotapi.BotAPI, openaiClient *openai.Client, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, gptConfig *config.Config, scenarioID string) {
+	userID := int(callbackQuery.From.ID)
+	scenario := findChatScenario(gptConfig.ChatScenarios, scenarioID)
+
+	language, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
+		return
+	}
+	if err := storage.StartChatSession(ctx, db, userID, language, scenario.ID, levelDifficulty(ctx, db, userID, language)); err != nil {
+		slog.ErrorContext(ctx, "Error starting chat session", "error", err)
+		return
+	}
+
+	msg := tgbotapi.NewEditMessageText(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID,
+		fmt.Sprintf("You picked the %s scenario. Reply in the language you are learning and I will gently point out mistakes. "+
+			"Choose /chat again to switch scenarios.", scenario.Label))
+	if _, err := send(ctx, bot, msg); err != nil {
+		slog.ErrorContext(ctx, "Error sending confirmation message", "error", err)
+	}
+
+	opening, err := processChatMessage(ctx, gptConfig, language, chatOpening, true, db, userID, openaiClient)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error opening conversation", "error", err)
+		return
+	}
+	if _, err := send(ctx, bot, tgbotapi.NewMessage(callbackQuery.Message.Chat.ID, opening)); err != nil {
+		slog.ErrorContext(ctx, "Error sending conversation opening", "error", err)
+	}
+}
+
+// ProcessChatMessage answers a message of the conversation practice mode.
+// The reply takes the scenario, the difficulty and the last messages of the
+// conversation into account and lists the mistakes of the message. The
+// difficulty is raised or lowered depending on how many mistakes the user
+// has made since it last changed.
+func ProcessChatMessage(ctx context.Context, gptConfig *config.Config, language string, message string, db *sql.DB, userID int, openaiClient *openai.Client) (string, error) {
+	return processChatMessage(ctx, gptConfig, language, message, false, db, userID, openaiClient)
+}
+
+// processChatMessage answers the message; an opening message is neither
+// stored nor checked for mistakes
+func processChatMessage(ctx context.Context, gptConfig *config.Config, language string, message string, opening bool, db *sql.DB, userID int, openaiClient *openai.Client) (response string, err error) {
+	ctx, span := tracing.Start(ctx, "bot.ProcessChatMessage", attribute.String("language", language))
+	defer func() { tracing.End(span, err) }()
+
+	if message == "" {
+		return "", errors.New("message is empty")
+	}
+	metrics.HelpTypeRequestsTotal.WithLabelValues("chat").Inc()
+
+	session, err := storage.GetChatSession(ctx, db, userID, language)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting chat session", "error", err)
+		return "", err
+	}
+	if session == nil {
+		// the user switched to chat without picking a scenario
+		session = &storage.ChatSession{Scenario: gptConfig.ChatScenarios[0].ID, Difficulty: levelDifficulty(ctx, db, userID, language)}
+		if err := storage.StartChatSession(ctx, db, userID, language, session.Scenario, session.Difficulty); err != nil {
+			slog.ErrorContext(ctx, "Error starting chat session", "error", err)
+			return "", err
+		}
+	}
+	scenario := findChatScenario(gptConfig.ChatScenarios, session.Scenario)
+	span.SetAttributes(attribute.String("chat.scenario", scenario.ID), attribute.Int("chat.difficulty", session.Difficulty))
+
+	history, err := storage.GetChatHistory(ctx, db, userID, language, gptConfig.ChatHistoryWindow)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting chat history", "error", err)
+		return "", err
+	}
+
+	gptRequest, err := BuildChatRequest(gptConfig, language, scenario, session.Difficulty, history, message)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error building chat request", "error", err)
+		return "", err
+	}
+
+	gptresponse, err := openai_api.GetGPTResponse(ctx, openaiClient, gptRequest)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting GPT response", "error", err)
+		return "", err
+	}
+	reply, err := answer.ParseChatReply(gptresponse)
+	if err != nil {
+		slog.WarnContext(ctx, "Error parsing chat reply", "error", err)
+		reply = &answer.ChatReply{Reply: gptresponse}
+	}
+
+	if !opening {
+		if err := storage.StoreChatMessage(ctx, db, userID, language, openai.ChatMessageRoleUser, message); err != nil {
+			slog.ErrorContext(ctx, "Error storing chat message", "error", err)
+		}
+		if err := storage.RecordMistakes(ctx, db, userID, language, "chat", correctionMistakes(reply.Corrections)); err != nil {
+			slog.ErrorContext(ctx, "Error recording mistakes", "error", err)
+		}
+	}
+	if err := storage.StoreChatMessage(ctx, db, userID, language, openai.ChatMessageRoleAssistant, reply.Reply); err != nil {
+		slog.ErrorContext(ctx, "Error storing chat message", "error", err)
+	}
+
+	response = reply.Render()
+	if !opening {
+		if change := adaptChatDifficulty(session, len(reply.Corrections) > 0); change != "" {
+			slog.InfoContext(ctx, "Chat difficulty changed", "difficulty", session.Difficulty)
+			response += "\n\n" + change
+		}
+		if err := storage.UpdateChatSession(ctx, db, userID, language, session); err != nil {
+			slog.ErrorContext(ctx, "Error updating chat session", "error", err)
+		}
+	}
+	return response, nil
+}
+
+// adaptChatDifficulty counts the message towards raising or lowering the
+// difficulty and returns a note for the user if the difficulty changed
+func adaptChatDifficulty(session *storage.ChatSession, hadMistakes bool) string {
+	if hadMistakes {
+		session.MistakeTurns++
+	} else {
+		session.CleanTurns++
+	}
+
+	difficulty := session.Difficulty
+	if session.CleanTurns >= chatLevelUpTurns && difficulty < len(chatDifficulties)-1 {
+		difficulty++
+	} else if session.MistakeTurns >= chatLevelDownTurns && difficulty > 0 {
+		difficulty--
+	}
+	if difficulty == session.Difficulty {
+		return ""
+	}
+
+	note := "You are doing great, let's make it a bit harder"
+	if difficulty < session.Difficulty {
+		note = "Let's make it a bit easier"
+	}
+	session.Difficulty = difficulty
+	session.CleanTurns = 0
+	session.MistakeTurns = 0
+	return fmt.Sprintf("(%s: %s level.)", note, chatDifficultyLabel(difficulty))
+}
+
+func chatDifficultyLabel(difficulty int) string {
+	if difficulty < 0 || difficulty >= len(chatDifficulties) {
+		return chatDifficulties[0]
+	}
+	return chatDifficulties[difficulty]
+}
+
+// BuildChatRequest renders the chat prompt template for the scenario and
+// difficulty and combines it with the conversation history into a request
+// for the message
+func BuildChatRequest(gptConfig *config.Config, language string, scenario config.ChatScenario, difficulty int, history []storage.ChatMessage, message string) (openai_api.GPTRequest, error) {
+	data := GptTemplateData{
+		Language:    language,
+		MessageText: message,
+		Scenario:    scenario.Description,
+		Difficulty:  chatDifficultyLabel(difficulty),
+	}
+
+	var gptPrompt strings.Builder
+	err := gptConfig.GptTemplateChat.PromptTemplate.Execute(&gptPrompt, data)
+	if err != nil {
+		return openai_api.GPTRequest{}, err
+	}
+
+	messages := make([]openai.ChatCompletionMessage, 0, len(history))
+	for _, m := range history {
+		messages = append(messages, openai.ChatCompletionMessage{Role: m.Role, Content: m.Content})
+	}
+
+	return openai_api.GPTRequest{
+		Model:                  gptConfig.ChatModel,
+		Prompt:                 gptPrompt.String(),
+		WordOrPhrase:           message,
+		ChatCompletionMessages: messages,
+		Schema:                 answer.ChatSchema,
+		SchemaName:             answer.ChatSchemaName,
+	}, nil
+}
@@ -0,0 +1,232 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"language-learning-bot/pkg/answer"
+	"language-learning-bot/pkg/metrics"
+	storage "language-learning-bot/pkg/storage"
+	"language-learning-bot/pkg/textmatch"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// clozeMaxDistance is the largest share of letters a word in a sentence may
+// differ from the looked up word to be taken as an inflected form of it
+const clozeMaxDistance = 0.5
+
+// clozeSentence is an example sentence of a looked up word
+type clozeSentence struct {
+	Word        string
+	Text        string
+	Translation string
+	// Forms are the looked up word and its known forms, to find in the sentence
+	Forms []string
+}
+
+// clozeSentences returns the example sentences of the words the user looked
+// up in examples mode, from the structured answers or parsed from the text
+// of older responses
+func clozeSentences(ctx context.Context, db *sql.DB, userID int, language string) ([]clozeSentence, error) {
+	lookups, err := storage.GetLookupResponses(ctx, db, userID, language, "examples")
+	if err != nil {
+		return nil, err
+	}
+
+	var sentences []clozeSentence
+	for _, lookup := range lookups {
+		if lookup.Structured == "" {
+			for _, example := range parseExamplesByNumber(lookup.Response) {
+				sentences = append(sentences, clozeSentence{Word: lookup.Word, Text: example, Forms: []string{lookup.Word}})
+			}
+			continue
+		}
+		structured, err := answer.Parse(lookup.Structured)
+		if err != nil {
+			slog.WarnContext(ctx, "Error parsing structured response", "error", err)
+			continue
+		}
+		forms := []string{structured.Headword}
+		for _, form := range structured.Forms {
+			forms = append(forms, form.Value)
+		}
+		for _, example := range structured.Examples {
+			sentences = append(sentences, clozeSentence{
+				Word:        structured.Headword,
+				Text:        example.Text,
+				Translation: example.Translation,
+				Forms:       forms,
+			})
+		}
+	}
+	return sentences, nil
+}
+
+// blankWord replaces the occurrence of the word, or the form of it that is
+// closest to one of forms, with a gap. It returns the sentence with the gap
+// and the removed word, or false if no word of the sentence is close enough.
+func blankWord(sentence string, forms []string) (string, string, bool) {
+	for _, form := range forms {
+		form = strings.TrimSpace(form)
+		if !strings.Contains(form, " ") {
+			continue
+		}
+		// phrases are only blanked where they appear as they are, in any case
+		if loc := regexp.MustCompile("(?i)" + regexp.QuoteMeta(form)).FindStringIndex(sentence); loc != nil {
+			return sentence[:loc[0]] + "___" + sentence[loc[1]:], sentence[loc[0]:loc[1]], true
+		}
+	}
+
+	tokens := strings.Fields(sentence)
+	bestToken, bestCore, bestDistance := -1, "", 0.0
+	for i, token := range tokens {
+		core := strings.TrimFunc(token, unicode.IsPunct)
+		if len([]rune(core)) < 2 {
+			continue
+		}
+		for _, form := range forms {
+			form = strings.TrimSpace(form)
+			if form == "" || strings.Contains(form, " ") {
+				continue
+			}
+			a, b := textmatch.Fold(core), textmatch.Fold(form)
+			distance := float64(textmatch.Distance(a, b)) / float64(max(len([]rune(a)), len([]rune(b))))
+			if distance <= clozeMaxDistance && (bestToken < 0 || distance < bestDistance) {
+				bestToken, bestCore, bestDistance = i, core, distance
+			}
+		}
+	}
+	if bestToken < 0 {
+		return "", "", false
+	}
+	tokens[bestToken] = strings.Replace(tokens[bestToken], bestCore, "___", 1)
+	return strings.Join(tokens, " "), bestCore, true
+}
+
+// newCloze blanks the looked up word in a random example sentence
+func newCloze(sentences []clozeSentence, userID int, language string) (storage.Exercise, bool) {
+	for _, i := range rand.Perm(len(sentences)) {
+		sentence := sentences[i]
+		blanked, word, ok := blankWord(sentence.Text, sentence.Forms)
+		if !ok {
+			continue
+		}
+		prompt := "🧩 Fill in the gap:\n" + blanked
+		if sentence.Translation != "" {
+			prompt += "\n(" + sentence.Translation + ")"
+		}
+		return storage.Exercise{
+			UserID:   userID,
+			Language: language,
+			Kind:     "cloze",
+			Word:     sentence.Word,
+			Prompt:   prompt,
+			Answer:   word,
+			Context:  sentence.Text,
+		}, true
+	}
+	return storage.Exercise{}, false
+}
+
+func handleClozeCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB) error {
+	userID := int(message.From.ID)
+	language, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
+		return err
+	}
+
+	prompt, err := nextCloze(ctx, db, userID, language)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error creating cloze", "error", err)
+		return err
+	}
+	if prompt == "" {
+		text := fmt.Sprintf("Look up some %s words in /examples mode first, then I can make gap fills from the example sentences.", language)
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+		return err
+	}
+
+	err = storage.UpdateUserHelpType(ctx, db, userID, "cloze")
+	if err != nil {
+		slog.ErrorContext(ctx, "Error updating user help_type", "error", err)
+		return err
+	}
+	text := "Let's fill in the gaps in the example sentences of the words you looked up. Choose another mode to stop.\n\n" + prompt
+	_, err = send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+	return err
+}
+
+// nextCloze stores a new cloze for the user and returns its prompt, or an
+// empty string if the user has no example sentences
+func nextCloze(ctx context.Context, db *sql.DB, userID int, language string) (string, error) {
+	sentences, err := clozeSentences(ctx, db, userID, language)
+	if err != nil {
+		return "", err
+	}
+	cloze, ok := newCloze(sentences, userID, language)
+	if !ok {
+		return "", nil
+	}
+	if _, err := storage.CreateExercise(ctx, db, cloze); err != nil {
+		return "", err
+	}
+	return cloze.Prompt, nil
+}
+
+// ProcessClozeAnswer checks the answer to the pending cloze of the user,
+// tolerating typos, and returns the next cloze with the result
+func ProcessClozeAnswer(ctx context.Context, language string, message string, db *sql.DB, userID int) (string, error) {
+	metrics.HelpTypeRequestsTotal.WithLabelValues("cloze").Inc()
+
+	cloze, err := storage.GetPendingExercise(ctx, db, userID, language, "cloze")
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting pending cloze", "error", err)
+		return "", err
+	}
+
+	var response strings.Builder
+	if cloze != nil {
+		score := 0.0
+		switch textmatch.CompareFuzzy(message, cloze.Answer) {
+		case textmatch.Correct:
+			score = 1
+			response.WriteString("✅ Correct!")
+		case textmatch.AccentsDiffer:
+			score = 1
+			fmt.Fprintf(&response, "✅ Correct, mind the accents: %s", cloze.Answer)
+		case textmatch.Typo:
+			score = 0.5
+			fmt.Fprintf(&response, "☑️ Almost, it is spelled: %s", cloze.Answer)
+		default:
+			fmt.Fprintf(&response, "❌ The missing word is: %s", cloze.Answer)
+			mistake := storage.Mistake{Category: "vocabulary", Original: message, Corrected: cloze.Answer}
+			if err := storage.RecordMistakes(ctx, db, userID, cloze.Language, "cloze", []storage.Mistake{mistake}); err != nil {
+				slog.ErrorContext(ctx, "Error recording mistakes", "error", err)
+			}
+		}
+		fmt.Fprintf(&response, "\n%s\n\n", cloze.Context)
+		if err := storage.AnswerExercise(ctx, db, cloze.ID, message, score); err != nil {
+			slog.ErrorContext(ctx, "Error storing cloze answer", "error", err)
+		}
+	}
+
+	prompt, err := nextCloze(ctx, db, userID, language)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error creating cloze", "error", err)
+		return "", err
+	}
+	if prompt == "" {
+		fmt.Fprintf(&response, "No more %s sentences to practice. Look up some words in /examples mode, then send /cloze again.", language)
+		return response.String(), nil
+	}
+	response.WriteString(prompt)
+	return response.String(), nil
+}
@@ -0,0 +1,210 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"strings"
+
+	"language-learning-bot/pkg/answer"
+	"language-learning-bot/pkg/config"
+	"language-learning-bot/pkg/diff"
+	"language-learning-bot/pkg/metrics"
+	openai_api "language-learning-bot/pkg/openai"
+	storage "language-learning-bot/pkg/storage"
+	"language-learning-bot/pkg/tracing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func handleCorrectCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client) error {
+	err := storage.UpdateUserHelpType(ctx, db, int(message.From.ID), "correct")
+	if err != nil {
+		slog.ErrorContext(ctx, "Error updating user help_type", "error", err)
+		return err
+	}
+	return nil
+}
+
+// ProcessCorrection corrects a text written by the user and stores the
+// categorized mistakes. The response is formatted as Telegram HTML with a
+// word diff of the changes.
+func ProcessCorrection(ctx context.Context, gptConfig *config.Config, language string, message string, db *sql.DB, userID int, openaiClient *openai.Client) (response string, err error) {
+	ctx, span := tracing.Start(ctx, "bot.ProcessCorrection", attribute.String("language", language))
+	defer func() { tracing.End(span, err) }()
+
+	if message == "" {
+		return "", errors.New("message is empty")
+	}
+	metrics.HelpTypeRequestsTotal.WithLabelValues("correct").Inc()
+
+	gptRequest, err := BuildCorrectionRequest(gptConfig, language, message)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error building correction request", "error", err)
+		return "", err
+	}
+	gptresponse, err := openai_api.GetGPTResponse(ctx, openaiClient, gptRequest)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting GPT response", "error", err)
+		return "", err
+	}
+
+	result, err := answer.ParseCorrection(gptresponse)
+	if err != nil {
+		slog.WarnContext(ctx, "Error parsing correction", "error", err)
+		return html.EscapeString(truncateText(gptresponse, maxMessageLength)), nil
+	}
+	span.SetAttributes(attribute.Int("corrections", len(result.Corrections)))
+
+	items := make([]storage.CorrectionItem, 0, len(result.Corrections))
+	for _, correction := range result.Corrections {
+		items = append(items, storage.CorrectionItem{
+			Category:    correction.Category,
+			Original:    correction.Original,
+			Corrected:   correction.Corrected,
+			Explanation: correction.Explanation,
+		})
+	}
+	_, err = storage.StoreCorrection(ctx, db, userID, language, message, result.Corrected, items)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error storing correction", "error", err)
+	}
+
+	return renderCorrection(message, result), nil
+}
+
+// correctionMistakes converts the corrections of the model into mistakes to record
+func correctionMistakes(corrections []answer.Correction) []storage.Mistake {
+	mistakes := make([]storage.Mistake, 0, len(corrections))
+	for _, correction := range corrections {
+		mistakes = append(mistakes, storage.Mistake{
+			Category:  correction.Category,
+			Original:  correction.Original,
+			Corrected: correction.Corrected,
+		})
+	}
+	return mistakes
+}
+
+// BuildCorrectionRequest renders the correction prompt template into a
+// request for the text
+func BuildCorrectionRequest(gptConfig *config.Config, language, message string) (openai_api.GPTRequest, error) {
+	data := GptTemplateData{
+		Language:    language,
+		MessageText: message,
+	}
+
+	var gptPrompt strings.Builder
+	err := gptConfig.GptTemplateCorrection.PromptTemplate.Execute(&gptPrompt, data)
+	if err != nil {
+		return openai_api.GPTRequest{}, err
+	}
+
+	return openai_api.GPTRequest{
+		Model:        gptConfig.ChatModel,
+		Prompt:       gptPrompt.String(),
+		WordOrPhrase: message,
+		Schema:       answer.CorrectionSchema,
+		SchemaName:   answer.CorrectionSchemaName,
+	}, nil
+}
+
+// maxMessageLength is the most characters Telegram accepts in a message
+const maxMessageLength = 4096
+
+// renderCorrection formats the corrected text, the word diff against the
+// original with removed words struck through and added words underlined,
+// and the explanation of every mistake. Only the corrected text is sent if
+// all of it does not fit in a message.
+func renderCorrection(original string, result *answer.CorrectionResult) string {
+	ops := diff.Words(original, result.Corrected)
+	if len(result.Corrections) == 0 && !diff.Changed(ops) {
+		return "✅ No mistakes found, well done!"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<b>Corrected:</b>\n%s\n\n", html.EscapeString(result.Corrected))
+
+	if diff.Changed(ops) {
+		b.WriteString("<b>Changes:</b>\n")
+		b.WriteString(renderWordDiff(ops))
+		b.WriteString("\n\n")
+	}
+
+	for i, correction := range result.Corrections {
+		fmt.Fprintf(&b, "%d. <s>%s</s> → <u>%s</u> <i>(%s)</i>",
+			i+1,
+			html.EscapeString(correction.Original),
+			html.EscapeString(correction.Corrected),
+			html.EscapeString(categoryLabel(correction.Category)))
+		if correction.Explanation != "" {
+			fmt.Fprintf(&b, "\n   %s", html.EscapeString(correction.Explanation))
+		}
+		b.WriteString("\n")
+	}
+	response := strings.TrimRight(b.String(), "\n")
+	if messageLength(response) > maxMessageLength {
+		const header = "Corrected:\n"
+		corrected := truncateText(result.Corrected, maxMessageLength-messageLength(header))
+		return "<b>Corrected:</b>\n" + html.EscapeString(corrected)
+	}
+	return response
+}
+
+// messageLength returns the length of the text the way Telegram counts it,
+// in UTF-16 code units. Tags and entities are counted too, so for HTML it is
+// an upper bound.
+func messageLength(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// truncateText cuts the text to at most limit UTF-16 code units, ending it
+// with an ellipsis if it was cut
+func truncateText(s string, limit int) string {
+	if messageLength(s) <= limit {
+		return s
+	}
+	n := 0
+	for i, r := range s {
+		size := 1
+		if r >= 0x10000 {
+			size = 2
+		}
+		if n+size > limit-1 {
+			return s[:i] + "…"
+		}
+		n += size
+	}
+	return s
+}
+
+// renderWordDiff joins the words of the diff as Telegram HTML, striking
+// through removed words and underlining added ones
+func renderWordDiff(ops []diff.Op) string {
+	words := make([]string, 0, len(ops))
+	for _, op := range ops {
+		text := html.EscapeString(op.Text)
+		switch op.Kind {
+		case diff.Delete:
+			words = append(words, "<s>"+text+"</s>")
+		case diff.Insert:
+			words = append(words, "<u>"+text+"</u>")
+		default:
+			words = append(words, text)
+		}
+	}
+	return strings.Join(words, " ")
+}
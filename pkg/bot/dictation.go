@@ -0,0 +1,235 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"log/slog"
+	"math/rand"
+	"strings"
+
+	"language-learning-bot/pkg/answer"
+	"language-learning-bot/pkg/config"
+	"language-learning-bot/pkg/diff"
+	"language-learning-bot/pkg/metrics"
+	openai_api "language-learning-bot/pkg/openai"
+	storage "language-learning-bot/pkg/storage"
+	"language-learning-bot/pkg/textmatch"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashabaranov/go-openai"
+)
+
+// dictationTopics are picked at random so that the sentences vary
+var dictationTopics = []string{
+	"daily routine", "food and cooking", "the weather", "travel", "family",
+	"work", "shopping", "hobbies", "the city", "health", "school", "holidays",
+}
+
+// dictationFileName names the voice notes so that they do not give the
+// sentence away
+const dictationFileName = "dictation"
+
+// userDifficulty returns the difficulty the user reached in conversation
+// practice in the language, or the one of the user's level in it if the user
+// has not chatted in it yet
+func userDifficulty(ctx context.Context, db *sql.DB, userID int, language string) int {
+	session, err := storage.GetChatSession(ctx, db, userID, language)
+	if err != nil {
+		slog.WarnContext(ctx, "Error getting chat session", "error", err)
+		return 0
+	}
+	if session == nil {
+		return levelDifficulty(ctx, db, userID, language)
+	}
+	return session.Difficulty
+}
+
+func handleDictationCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config) error {
+	userID := int(message.From.ID)
+	language, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
+		return err
+	}
+
+	err = storage.UpdateUserHelpType(ctx, db, userID, "dictation")
+	if err != nil {
+		slog.ErrorContext(ctx, "Error updating user help_type", "error", err)
+		return err
+	}
+	text := fmt.Sprintf("Listen to the %s sentence and type what you hear. Choose another mode to stop.", language)
+	if _, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text)); err != nil {
+		slog.ErrorContext(ctx, "Error sending dictation instructions", "error", err)
+		return err
+	}
+	return sendNextDictation(ctx, bot, db, openaiClient, gptConfig, userID, language)
+}
+
+// sendNextDictation generates a sentence at the level of the user, stores it
+// as a pending dictation and sends it as a voice note without the text
+func sendNextDictation(ctx context.Context, bot *tgbotapi.BotAPI, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config, userID int, language string) error {
+	gptRequest, err := BuildDictationRequest(gptConfig, language, userDifficulty(ctx, db, userID, language))
+	if err != nil {
+		slog.ErrorContext(ctx, "Error building dictation request", "error", err)
+		return err
+	}
+	gptresponse, err := openai_api.GetGPTResponse(ctx, openaiClient, gptRequest)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting GPT response", "error", err)
+		return err
+	}
+	dictation, err := answer.ParseDictation(gptresponse)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error parsing dictation", "error", err)
+		return err
+	}
+
+	_, err = storage.CreateExercise(ctx, db, storage.Exercise{
+		UserID:   userID,
+		Language: language,
+		Kind:     "dictation",
+		Prompt:   gptRequest.WordOrPhrase,
+		Answer:   dictation.Sentence,
+		Context:  dictation.Translation,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error storing dictation", "error", err)
+		return err
+	}
+	return sendVoice(ctx, openaiClient, db, dictation.Sentence, dictationFileName, userID, bot, gptConfig.TTSConfig)
+}
+
+// BuildDictationRequest renders the dictation prompt template into a request
+// for a sentence about a random topic
+func BuildDictationRequest(gptConfig *config.Config, language string, difficulty int) (openai_api.GPTRequest, error) {
+	data := GptTemplateData{
+		Language:   language,
+		Difficulty: chatDifficultyLabel(difficulty),
+	}
+
+	var gptPrompt strings.Builder
+	err := gptConfig.GptTemplateDictation.PromptTemplate.Execute(&gptPrompt, data)
+	if err != nil {
+		return openai_api.GPTRequest{}, err
+	}
+
+	return openai_api.GPTRequest{
+		Model:        gptConfig.ChatModel,
+		Prompt:       gptPrompt.String(),
+		WordOrPhrase: dictationTopics[rand.Intn(len(dictationTopics))],
+		Schema:       answer.DictationSchema,
+		SchemaName:   answer.DictationSchemaName,
+	}, nil
+}
+
+// handleDictationAnswer scores what the user typed against the pending
+// dictation, sends the result and the next voice note
+func handleDictationAnswer(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config, language string) error {
+	metrics.HelpTypeRequestsTotal.WithLabelValues("dictation").Inc()
+	userID := int(message.From.ID)
+
+	dictation, err := storage.GetPendingExercise(ctx, db, userID, language, "dictation")
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting pending dictation", "error", err)
+		return err
+	}
+
+	if dictation != nil {
+		response, score, mistakes := scoreDictation(message.Text, dictation)
+		if err := storage.AnswerExercise(ctx, db, dictation.ID, message.Text, score); err != nil {
+			slog.ErrorContext(ctx, "Error storing dictation answer", "error", err)
+		}
+		if len(mistakes) > 0 {
+			if err := storage.RecordMistakes(ctx, db, userID, dictation.Language, "dictation", mistakes); err != nil {
+				slog.ErrorContext(ctx, "Error recording mistakes", "error", err)
+			}
+		}
+
+		msg := tgbotapi.NewMessage(message.Chat.ID, response)
+		msg.ParseMode = tgbotapi.ModeHTML
+		if _, err := send(ctx, bot, msg); err != nil {
+			slog.ErrorContext(ctx, "Error sending dictation result", "error", err)
+			return err
+		}
+	}
+	return sendNextDictation(ctx, bot, db, openaiClient, gptConfig, userID, language)
+}
+
+// scoreDictation compares the transcription with the sentence ignoring case
+// and punctuation. It returns the result as Telegram HTML, the share of
+// characters typed right as the score and the misspelled words.
+func scoreDictation(typed string, dictation *storage.Exercise) (string, float64, []storage.Mistake) {
+	typedWords, sentenceWords := textmatch.Words(typed), textmatch.Words(dictation.Answer)
+	wordOps := diff.Strings(typedWords, sentenceWords)
+	charOps := diff.Chars(strings.Join(typedWords, " "), strings.Join(sentenceWords, " "))
+
+	charScore := accuracy(charOps)
+	wordScore := accuracy(wordOps)
+
+	var b strings.Builder
+	if !diff.Changed(wordOps) {
+		b.WriteString("✅ Perfect!\n")
+	} else {
+		fmt.Fprintf(&b, "<b>Characters:</b> %.0f%%, <b>words:</b> %.0f%%\n", charScore*100, wordScore*100)
+		fmt.Fprintf(&b, "%s\n<i>(struck through: typed wrong, underlined: missed)</i>\n", renderWordDiff(wordOps))
+	}
+	fmt.Fprintf(&b, "\n%s", html.EscapeString(dictation.Answer))
+	if dictation.Context != "" {
+		fmt.Fprintf(&b, "\n(%s)", html.EscapeString(dictation.Context))
+	}
+	return b.String(), charScore, dictationMistakes(wordOps)
+}
+
+// accuracy is the share of tokens kept of the longer of both sequences
+func accuracy(ops []diff.Op) float64 {
+	var equal, deleted, inserted int
+	for _, op := range ops {
+		switch op.Kind {
+		case diff.Equal:
+			equal++
+		case diff.Delete:
+			deleted++
+		case diff.Insert:
+			inserted++
+		}
+	}
+	total := equal + max(deleted, inserted)
+	if total == 0 {
+		return 1
+	}
+	return float64(equal) / float64(total)
+}
+
+// dictationMistakes returns the words that were typed in place of words of
+// the sentence. Words that were only missed or only added are left out.
+func dictationMistakes(ops []diff.Op) []storage.Mistake {
+	var mistakes []storage.Mistake
+	var deleted, inserted []string
+	flush := func() {
+		if len(deleted) > 0 && len(inserted) > 0 {
+			mistakes = append(mistakes, storage.Mistake{
+				Category:  "spelling",
+				Original:  strings.Join(deleted, " "),
+				Corrected: strings.Join(inserted, " "),
+			})
+		}
+		deleted, inserted = nil, nil
+	}
+	for _, op := range ops {
+		switch op.Kind {
+		case diff.Delete:
+			if len(inserted) > 0 {
+				flush()
+			}
+			deleted = append(deleted, op.Text)
+		case diff.Insert:
+			inserted = append(inserted, op.Text)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return mistakes
+}
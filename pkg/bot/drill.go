@@ -0,0 +1,186 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strings"
+
+	"language-learning-bot/pkg/answer"
+	"language-learning-bot/pkg/metrics"
+	storage "language-learning-bot/pkg/storage"
+	"language-learning-bot/pkg/textmatch"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// drillableWord is a word looked up in inflection mode with its forms
+type drillableWord struct {
+	Headword string
+	Forms    []answer.Form
+}
+
+// drillableWords returns the words the user looked up in inflection mode
+// that have forms to practice, verbs only if there are any
+func drillableWords(ctx context.Context, db *sql.DB, userID int, language string) ([]drillableWord, error) {
+	lookups, err := storage.GetStructuredLookups(ctx, db, userID, language)
+	if err != nil {
+		return nil, err
+	}
+
+	var words, verbs []drillableWord
+	for _, lookup := range lookups {
+		if lookup.HelpType != "inflection" {
+			continue
+		}
+		structured, err := answer.Parse(lookup.Structured)
+		if err != nil {
+			slog.WarnContext(ctx, "Error parsing structured response", "error", err)
+			continue
+		}
+		if len(structured.Forms) == 0 {
+			continue
+		}
+		word := drillableWord{Headword: structured.Headword, Forms: structured.Forms}
+		words = append(words, word)
+		if strings.Contains(strings.ToLower(structured.PartOfSpeech), "verb") {
+			verbs = append(verbs, word)
+		}
+	}
+	if len(verbs) > 0 {
+		return verbs, nil
+	}
+	return words, nil
+}
+
+// newDrill picks a random form of a random word to ask for
+func newDrill(words []drillableWord, userID int, language string) storage.Exercise {
+	word := words[rand.Intn(len(words))]
+	form := word.Forms[rand.Intn(len(word.Forms))]
+
+	var table strings.Builder
+	for _, f := range word.Forms {
+		fmt.Fprintf(&table, "%s: %s\n", f.Label, f.Value)
+	}
+	return storage.Exercise{
+		UserID:   userID,
+		Language: language,
+		Kind:     "drill",
+		Word:     word.Headword,
+		Prompt:   fmt.Sprintf("🏋️ %s\nType the form: %s", word.Headword, form.Label),
+		Answer:   form.Value,
+		Context:  strings.TrimRight(table.String(), "\n"),
+	}
+}
+
+// drillAlternatives returns the accepted answers for a form such as
+// "ik eet" or "at / aten". The pronoun may be left out of forms of a person.
+func drillAlternatives(prompt, value string) []string {
+	personal := strings.Contains(strings.ToLower(prompt), "person")
+	var alternatives []string
+	for _, alternative := range strings.FieldsFunc(value, func(r rune) bool { return r == '/' || r == ',' || r == ';' }) {
+		alternative = strings.TrimSpace(alternative)
+		if alternative == "" {
+			continue
+		}
+		alternatives = append(alternatives, alternative)
+		if _, withoutPronoun, found := strings.Cut(alternative, " "); found && personal {
+			alternatives = append(alternatives, withoutPronoun)
+		}
+	}
+	return alternatives
+}
+
+func handleDrillCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB) error {
+	userID := int(message.From.ID)
+	language, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
+		return err
+	}
+
+	prompt, err := nextDrill(ctx, db, userID, language)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error creating drill", "error", err)
+		return err
+	}
+	if prompt == "" {
+		text := fmt.Sprintf("Look up some %s verbs in /inflection mode first, then I can drill you on their forms.", language)
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+		return err
+	}
+
+	err = storage.UpdateUserHelpType(ctx, db, userID, "drill")
+	if err != nil {
+		slog.ErrorContext(ctx, "Error updating user help_type", "error", err)
+		return err
+	}
+	text := "Let's practice the forms of the words you looked up. Accents may be left out. Choose another mode to stop.\n\n" + prompt
+	_, err = send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+	return err
+}
+
+// nextDrill stores a new drill for the user and returns its prompt, or an
+// empty string if the user has no words to drill
+func nextDrill(ctx context.Context, db *sql.DB, userID int, language string) (string, error) {
+	words, err := drillableWords(ctx, db, userID, language)
+	if err != nil || len(words) == 0 {
+		return "", err
+	}
+	drill := newDrill(words, userID, language)
+	if _, err := storage.CreateExercise(ctx, db, drill); err != nil {
+		return "", err
+	}
+	return drill.Prompt, nil
+}
+
+// ProcessDrillAnswer checks the answer to the pending drill of the user,
+// explains the correct form on mistakes and returns the next drill with
+// the result
+func ProcessDrillAnswer(ctx context.Context, language string, message string, db *sql.DB, userID int) (string, error) {
+	metrics.HelpTypeRequestsTotal.WithLabelValues("drill").Inc()
+
+	drill, err := storage.GetPendingExercise(ctx, db, userID, language, "drill")
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting pending drill", "error", err)
+		return "", err
+	}
+
+	var response strings.Builder
+	if drill != nil {
+		result := textmatch.Compare(message, drillAlternatives(drill.Prompt, drill.Answer)...)
+		score := 0.0
+		switch result {
+		case textmatch.Correct:
+			score = 1
+			response.WriteString("✅ Correct!")
+		case textmatch.AccentsDiffer:
+			score = 1
+			fmt.Fprintf(&response, "✅ Correct, mind the accents: %s", drill.Answer)
+		default:
+			fmt.Fprintf(&response, "❌ The form is: %s\n\nAll forms of %s:\n%s", drill.Answer, drill.Word, drill.Context)
+			mistake := storage.Mistake{Category: "conjugation", Original: message, Corrected: drill.Answer}
+			if err := storage.RecordMistakes(ctx, db, userID, drill.Language, "drill", []storage.Mistake{mistake}); err != nil {
+				slog.ErrorContext(ctx, "Error recording mistakes", "error", err)
+			}
+		}
+		if err := storage.AnswerExercise(ctx, db, drill.ID, message, score); err != nil {
+			slog.ErrorContext(ctx, "Error storing drill answer", "error", err)
+		}
+		response.WriteString("\n\n")
+	}
+
+	prompt, err := nextDrill(ctx, db, userID, language)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error creating drill", "error", err)
+		return "", err
+	}
+	if prompt == "" {
+		fmt.Fprintf(&response, "No more %s verbs to practice. Look up some in /inflection mode, then send /drill again.", language)
+		return response.String(), nil
+	}
+	response.WriteString(prompt)
+	return response.String(), nil
+}
@@ -0,0 +1,97 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"language-learning-bot/pkg/anki"
+	"language-learning-bot/pkg/export"
+	storage "language-learning-bot/pkg/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleExportAnkiCommand sends the saved words of the user as an Anki deck,
+// with their pronunciation unless "/export_anki text" is asked for
+func handleExportAnkiCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB) error {
+	userID := int(message.From.ID)
+	language, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
+		return err
+	}
+
+	withAudio := strings.TrimSpace(message.CommandArguments()) != "text"
+	deck, err := anki.VocabularyDeck(ctx, db, userID, language, withAudio)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error building Anki deck", "error", err)
+		return err
+	}
+	if len(deck.Cards) == 0 {
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("You have no saved %s words to export yet. Use /save after looking up a word.", language)))
+		return err
+	}
+
+	var apkg bytes.Buffer
+	if err := anki.Write(&apkg, deck); err != nil {
+		slog.ErrorContext(ctx, "Error writing Anki deck", "error", err)
+		return err
+	}
+	document := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("langekko-%s.apkg", language),
+		Bytes: apkg.Bytes(),
+	})
+	document.Caption = fmt.Sprintf("%d %s words. Open the file with Anki to import them.", len(deck.Cards), language)
+	if _, err := send(ctx, bot, document); err != nil {
+		slog.ErrorContext(ctx, "Error sending Anki deck", "error", err)
+		return err
+	}
+	return nil
+}
+
+// handleExportCommand sends the history, saved words and review stats of the
+// user as files, e.g. "/export vocabulary json"; all of them as CSV by default
+func handleExportCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB) error {
+	kinds, format := export.Kinds, "csv"
+	for _, argument := range strings.Fields(strings.ToLower(message.CommandArguments())) {
+		switch {
+		case slices.Contains(export.Kinds, argument):
+			kinds = []string{argument}
+		case slices.Contains(export.Formats, argument):
+			format = argument
+		default:
+			text := fmt.Sprintf("Usage: /export [%s] [%s]", strings.Join(export.Kinds, "|"), strings.Join(export.Formats, "|"))
+			_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+			return err
+		}
+	}
+
+	userID := int(message.From.ID)
+	for _, kind := range kinds {
+		table, err := export.Build(ctx, db, userID, kind)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error building export", "error", err, "kind", kind)
+			return err
+		}
+		var content bytes.Buffer
+		if err := export.Write(&content, table, format); err != nil {
+			slog.ErrorContext(ctx, "Error writing export", "error", err, "kind", kind)
+			return err
+		}
+		document := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{
+			Name:  fmt.Sprintf("langekko-%s.%s", kind, format),
+			Bytes: content.Bytes(),
+		})
+		document.Caption = fmt.Sprintf("Your %s: %d rows.", kind, len(table.Rows))
+		if _, err := send(ctx, bot, document); err != nil {
+			slog.ErrorContext(ctx, "Error sending export", "error", err, "kind", kind)
+			return err
+		}
+	}
+	return nil
+}
@@ -5,61 +5,234 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 
+	"language-learning-bot/pkg/answer"
 	"language-learning-bot/pkg/config"
+	"language-learning-bot/pkg/logging"
+	"language-learning-bot/pkg/metrics"
 	openai_api "language-learning-bot/pkg/openai"
 	storage "language-learning-bot/pkg/storage"
+	"language-learning-bot/pkg/tracing"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func HandleCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client) error {
-	// log the command to the console
-	log.Printf("%d [%s] %s", message.From.ID, message.From.UserName, message.Text)
+// send sends the message to Telegram inside a trace span
+func send(ctx context.Context, bot *tgbotapi.BotAPI, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	_, span := tracing.Start(ctx, "telegram.Send")
+	msg, err := bot.Send(c)
+	tracing.End(span, err)
+	return msg, err
+}
+
+// request makes a Telegram API request inside a trace span
+func request(ctx context.Context, bot *tgbotapi.BotAPI, c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	_, span := tracing.Start(ctx, "telegram.Request")
+	resp, err := bot.Request(c)
+	tracing.End(span, err)
+	return resp, err
+}
+
+// commands are the commands HandleCommand knows, the only ones counted by
+// name so that made up commands don't grow the metric without bound
+var commands = map[string]bool{
+	"healthz":       true,
+	"start":         true,
+	"speech_speed":  true,
+	"examples":      true,
+	"translation":   true,
+	"pronunciation": true,
+	"chat":          true,
+	"correct":       true,
+	"weaknesses":    true,
+	"practice":      true,
+	"quiz":          true,
+	"drill":         true,
+	"cloze":         true,
+	"lang":          true,
+	"level":         true,
+	"dictation":     true,
+	"export_anki":   true,
+	"export":        true,
+	"import":        true,
+	"word_of_day":   true,
+	"words":         true,
+	"save":          true,
+	"forget":        true,
+	"tag":           true,
+	"inflection":    true,
+}
+
+// commandLabel returns the metric label of the command, "other" for commands
+// the bot does not know
+func commandLabel(command string) string {
+	if commands[command] {
+		return command
+	}
+	return "other"
+}
+
+func HandleCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config) error {
+	ctx = logging.WithCommand(ctx, message.Command())
+	slog.InfoContext(ctx, "Handling command", "text", logging.Redact(message.Text))
 	response := ""
+	metrics.CommandsTotal.WithLabelValues(commandLabel(message.Command())).Inc()
 	switch message.Command() {
 	case "healthz":
 		response = "OK"
+		if err := db.PingContext(ctx); err != nil {
+			slog.ErrorContext(ctx, "Error pinging database", "error", err)
+			response = "Database is unavailable"
+		}
 	case "start":
-		if err := sendLanguageSelection(bot, message.Chat.ID); err != nil {
-			log.Printf("Error sending language selection: %v\n", err)
+		if err := sendLanguageSelection(ctx, bot, message.Chat.ID); err != nil {
+			slog.ErrorContext(ctx, "Error sending language selection", "error", err)
 			return err
 		}
 		response = ""
 	case "speech_speed":
-		if err := sendSpeechSpeedSelection(bot, message.Chat.ID); err != nil {
-			log.Printf("Error sending speech speed selection: %v\n", err)
+		if err := sendSpeechSpeedSelection(ctx, bot, message.Chat.ID, gptConfig.SpeechSpeeds); err != nil {
+			slog.ErrorContext(ctx, "Error sending speech speed selection", "error", err)
 			return err
 		}
 	case "examples":
-		if err := handleExamplesCommand(bot, message, db, openaiClient); err != nil {
-			log.Printf("Error handling examples command: %v\n", err)
+		if err := handleExamplesCommand(ctx, bot, message, db, openaiClient); err != nil {
+			slog.ErrorContext(ctx, "Error handling examples command", "error", err)
 			return err
 		}
 		response = "I will respond with examples of the word or phrase usage."
 
 	case "translation":
-		if err := handleTranslationCommand(bot, message, db, openaiClient); err != nil {
-			log.Printf("Error handling translation command: %v\n", err)
+		if err := handleTranslationCommand(ctx, bot, message, db, openaiClient); err != nil {
+			slog.ErrorContext(ctx, "Error handling translation command", "error", err)
 			return err
 		}
 		response = "I will respond with translations."
 
 	case "pronunciation":
-		if err := handlePronounciationCommand(bot, message, db, openaiClient); err != nil {
-			log.Printf("Error handling pronounciation command: %v\n", err)
+		if err := handlePronounciationCommand(ctx, bot, message, db, openaiClient, gptConfig); err != nil {
+			slog.ErrorContext(ctx, "Error handling pronounciation command", "error", err)
+			return err
+		}
+
+	case "chat":
+		if err := handleChatCommand(ctx, bot, message, db, gptConfig.ChatScenarios); err != nil {
+			slog.ErrorContext(ctx, "Error handling chat command", "error", err)
+			return err
+		}
+
+	case "correct":
+		if err := handleCorrectCommand(ctx, bot, message, db, openaiClient); err != nil {
+			slog.ErrorContext(ctx, "Error handling correct command", "error", err)
+			return err
+		}
+		response = "Send me a text you wrote and I will correct it and explain the mistakes."
+
+	case "weaknesses":
+		if err := handleWeaknessesCommand(ctx, bot, message, db); err != nil {
+			slog.ErrorContext(ctx, "Error handling weaknesses command", "error", err)
+			return err
+		}
+
+	case "practice":
+		if err := handlePracticeCommand(ctx, bot, message, db, openaiClient, gptConfig); err != nil {
+			slog.ErrorContext(ctx, "Error handling practice command", "error", err)
+			return err
+		}
+
+	case "quiz":
+		if err := handleQuizCommand(ctx, bot, message, db); err != nil {
+			slog.ErrorContext(ctx, "Error handling quiz command", "error", err)
+			return err
+		}
+
+	case "drill":
+		if err := handleDrillCommand(ctx, bot, message, db); err != nil {
+			slog.ErrorContext(ctx, "Error handling drill command", "error", err)
+			return err
+		}
+
+	case "cloze":
+		if err := handleClozeCommand(ctx, bot, message, db); err != nil {
+			slog.ErrorContext(ctx, "Error handling cloze command", "error", err)
+			return err
+		}
+
+	case "lang":
+		if err := handleLangCommand(ctx, bot, message, db); err != nil {
+			slog.ErrorContext(ctx, "Error handling lang command", "error", err)
+			return err
+		}
+
+	case "level":
+		if err := handleLevelCommand(ctx, bot, message, db, openaiClient, gptConfig); err != nil {
+			slog.ErrorContext(ctx, "Error handling level command", "error", err)
+			return err
+		}
+
+	case "dictation":
+		if err := handleDictationCommand(ctx, bot, message, db, openaiClient, gptConfig); err != nil {
+			slog.ErrorContext(ctx, "Error handling dictation command", "error", err)
+			return err
+		}
+
+	case "export_anki":
+		if err := handleExportAnkiCommand(ctx, bot, message, db); err != nil {
+			slog.ErrorContext(ctx, "Error handling export anki command", "error", err)
+			return err
+		}
+
+	case "export":
+		if err := handleExportCommand(ctx, bot, message, db); err != nil {
+			slog.ErrorContext(ctx, "Error handling export command", "error", err)
+			return err
+		}
+
+	case "import":
+		if err := handleImportCommand(ctx, bot, message); err != nil {
+			slog.ErrorContext(ctx, "Error handling import command", "error", err)
+			return err
+		}
+
+	case "word_of_day":
+		if err := handleWordOfDayCommand(ctx, bot, message, db, gptConfig); err != nil {
+			slog.ErrorContext(ctx, "Error handling word of the day command", "error", err)
+			return err
+		}
+
+	case "words":
+		if err := handleWordsCommand(ctx, bot, message, db); err != nil {
+			slog.ErrorContext(ctx, "Error handling words command", "error", err)
+			return err
+		}
+
+	case "save":
+		if err := handleSaveCommand(ctx, bot, message, db); err != nil {
+			slog.ErrorContext(ctx, "Error handling save command", "error", err)
+			return err
+		}
+
+	case "forget":
+		if err := handleForgetCommand(ctx, bot, message, db); err != nil {
+			slog.ErrorContext(ctx, "Error handling forget command", "error", err)
+			return err
+		}
+
+	case "tag":
+		if err := handleTagCommand(ctx, bot, message, db); err != nil {
+			slog.ErrorContext(ctx, "Error handling tag command", "error", err)
 			return err
 		}
 
 	case "inflection":
-		if err := handleInflectionCommand(bot, message, db, openaiClient); err != nil {
-			log.Printf("Error handling inflection command: %v\n", err)
+		if err := handleInflectionCommand(ctx, bot, message, db, openaiClient); err != nil {
+			slog.ErrorContext(ctx, "Error handling inflection command", "error", err)
 			return err
 		}
 		response = "I will respond with inflection (if applicable) for the provided word."
@@ -68,9 +241,9 @@ func HandleCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.
 	// send the response to the user
 	if response != "" {
 		msg := tgbotapi.NewMessage(message.Chat.ID, response)
-		_, err := bot.Send(msg)
+		_, err := send(ctx, bot, msg)
 		if err != nil {
-			log.Printf("Error sending response: %v\n", err)
+			slog.ErrorContext(ctx, "Error sending response", "error", err)
 			return err
 		}
 	}
@@ -94,95 +267,140 @@ func parseExamplesByNumber(message string) []string {
 	return examples
 }
 
-func handlePronounciationCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client) error {
+func handlePronounciationCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config) error {
 	userId := int(message.From.ID)
-	sendLastRequestAudio(db, userId, 0, message.Text, openaiClient, bot)
+	sendLastRequestAudio(ctx, db, userId, 0, message.Text, openaiClient, bot, gptConfig)
 
 	return nil
 }
 
-func handleInflectionCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client) error {
-	err := storage.UpdateUserHelpType(db, int(message.From.ID), "inflection")
+func handleInflectionCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client) error {
+	err := storage.UpdateUserHelpType(ctx, db, int(message.From.ID), "inflection")
 	if err != nil {
-		log.Printf("Error updating user help_type: %v\n", err)
+		slog.ErrorContext(ctx, "Error updating user help_type", "error", err)
 		return err
 	}
 	return nil
 }
 
-func handleExamplesCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client) error {
-	err := storage.UpdateUserHelpType(db, int(message.From.ID), "examples")
+func handleExamplesCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client) error {
+	err := storage.UpdateUserHelpType(ctx, db, int(message.From.ID), "examples")
 	if err != nil {
-		log.Printf("Error updating user help_type: %v\n", err)
+		slog.ErrorContext(ctx, "Error updating user help_type", "error", err)
 		return err
 	}
 	return nil
 }
 
-func handleTranslationCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client) error {
-	err := storage.UpdateUserHelpType(db, int(message.From.ID), "translation")
+func handleTranslationCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client) error {
+	err := storage.UpdateUserHelpType(ctx, db, int(message.From.ID), "translation")
 	if err != nil {
-		log.Printf("Error updating user help_type: %v\n", err)
+		slog.ErrorContext(ctx, "Error updating user help_type", "error", err)
 		return err
 	}
 	return nil
 }
 
-func sendAudioMessage(openaiClient *openai.Client, db *sql.DB, firstLine string, userid int, bot *tgbotapi.BotAPI) error {
-	userSpeechSpeed, err := storage.GetUserSpeechSpeed(db, userid)
+func sendAudioMessage(ctx context.Context, openaiClient *openai.Client, db *sql.DB, firstLine string, userid int, bot *tgbotapi.BotAPI, ttsConfig *config.TTSConfig) error {
+	return sendVoice(ctx, openaiClient, db, firstLine, firstLine, userid, bot, ttsConfig)
+}
 
-	if err != nil {
-		log.Println("Failed to get user speech speed: ", err)
-		userSpeechSpeed = 1.0
-	}
+// sendVoice sends the text spoken at the user's speech speed as a voice
+// message with the given file name
+func sendVoice(ctx context.Context, openaiClient *openai.Client, db *sql.DB, text string, name string, userid int, bot *tgbotapi.BotAPI, ttsConfig *config.TTSConfig) error {
+	userSpeechSpeed, err := storage.GetUserSpeechSpeed(ctx, db, userid)
 
-	openaiResponse, err := openai_api.GetTTSResponse(context.Background(), openaiClient, userSpeechSpeed, firstLine)
+	if err != nil || userSpeechSpeed <= 0 {
+		slog.WarnContext(ctx, "Failed to get user speech speed", "error", err)
+		userSpeechSpeed = ttsConfig.Speed
+	}
 
+	openaiResponse, err := storage.GetCachedTTS(ctx, db, text, ttsConfig.Model, ttsConfig.Voice, userSpeechSpeed)
 	if err != nil {
-		log.Printf("Error getting TTS response: %v\n", err)
-		return err
+		slog.WarnContext(ctx, "Error getting cached TTS", "error", err)
+	}
+	if openaiResponse == nil {
+		openaiResponse, err = openai_api.GetTTSResponse(ctx, openaiClient, openai_api.TTSRequest{
+			Model: ttsConfig.Model,
+			Voice: ttsConfig.Voice,
+			Speed: userSpeechSpeed,
+			Text:  text,
+		})
+
+		if err != nil {
+			slog.ErrorContext(ctx, "Error getting TTS response", "error", err)
+			return err
+		}
+		err = storage.CacheTTS(ctx, db, text, ttsConfig.Model, ttsConfig.Voice, userSpeechSpeed, openaiResponse)
+		if err != nil {
+			slog.WarnContext(ctx, "Error caching TTS", "error", err)
+		}
 	}
 
-	audio := tgbotapi.FileBytes{Name: fmt.Sprintf("%s.mp3", firstLine), Bytes: openaiResponse}
+	audio := tgbotapi.FileBytes{Name: fmt.Sprintf("%s.mp3", name), Bytes: openaiResponse}
 	audioMsg := tgbotapi.NewVoice(int64(userid), audio)
-	_, err = bot.Send(audioMsg)
+	_, err = send(ctx, bot, audioMsg)
 	if err != nil {
-		log.Printf("Error sending audio message: %v\n", err)
+		slog.ErrorContext(ctx, "Error sending audio message", "error", err)
 		return err
 	}
 	return nil
 }
 
-func HandleCallbackQuery(bot *tgbotapi.BotAPI, openaiClient *openai.Client, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB) {
+func HandleCallbackQuery(ctx context.Context, bot *tgbotapi.BotAPI, openaiClient *openai.Client, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, gptConfig *config.Config) {
 	data := callbackQuery.Data
 	if strings.HasPrefix(data, "language:") {
 		language := strings.Split(data, ":")[1]
-		updateLanguagePreference(bot, callbackQuery, db, language, 0)
+		updateLanguagePreference(ctx, bot, callbackQuery, db, language, 0)
+	}
+
+	if strings.HasPrefix(data, "chat_scenario:") {
+		handleChatScenarioCallback(ctx, bot, openaiClient, callbackQuery, db, gptConfig, strings.TrimPrefix(data, "chat_scenario:"))
+	}
+
+	if strings.HasPrefix(data, "quiz:") {
+		handleQuizCallback(ctx, bot, callbackQuery, db, data)
+	}
+
+	if strings.HasPrefix(data, "lang:") || data == "lang_add" {
+		handleLangCallback(ctx, bot, callbackQuery, db, data)
+	}
+
+	if strings.HasPrefix(data, "level:") {
+		handlePlacementCallback(ctx, bot, callbackQuery, db, openaiClient, gptConfig, data)
+	}
+
+	if strings.HasPrefix(data, "words:") {
+		handleWordsCallback(ctx, bot, callbackQuery, db, data)
+	}
+
+	if strings.HasPrefix(data, "word_of_day:") {
+		handleWordOfDayCallback(ctx, bot, callbackQuery, db, data)
 	}
 
 	if strings.HasPrefix(data, "pronunciation:") {
 		// parse the number from the callback data into an int
 		exampleNumber, err := strconv.Atoi(strings.Split(data, ":")[1])
 		if err != nil {
-			log.Printf("Error parsing example number: %v\n", err)
+			slog.ErrorContext(ctx, "Error parsing example number", "error", err)
 			return
 		}
-		log.Println("Pronounciation example: ", exampleNumber)
+		slog.DebugContext(ctx, "Pronounciation example", "example", exampleNumber)
 
 		msg := tgbotapi.NewEditMessageText(callbackQuery.Message.Chat.ID,
 			callbackQuery.Message.MessageID,
 			fmt.Sprintf("You picked number %d. The pronunciation will be sent to you shortly."+
 				"If it does not pop up in a few seconds, please choose /pronunciation from the menu and try again!", exampleNumber))
-		_, err = bot.Send(msg)
+		_, err = send(ctx, bot, msg)
 		if err != nil {
-			log.Printf("Error sending confirmation message: %v\n", err)
+			slog.ErrorContext(ctx, "Error sending confirmation message", "error", err)
 		}
 		userId := int(callbackQuery.From.ID)
 
 		// send the Nth example
-		shouldReturn := sendLastRequestAudio(db, userId, exampleNumber, callbackQuery.Message.Text, openaiClient, bot)
+		shouldReturn := sendLastRequestAudio(ctx, db, userId, exampleNumber, callbackQuery.Message.Text, openaiClient, bot, gptConfig)
 		if shouldReturn {
-			log.Printf("Error sending last request audio")
+			slog.ErrorContext(ctx, "Error sending last request audio")
 			return
 		}
 	}
@@ -192,56 +410,74 @@ func HandleCallbackQuery(bot *tgbotapi.BotAPI, openaiClient *openai.Client, call
 		// parse the number from the callback data into an int
 		speechSpeed, err := strconv.ParseFloat(strings.Split(data, ":")[1], 64)
 		if err != nil {
-			log.Printf("Error parsing speech speed: %v\n", err)
+			slog.ErrorContext(ctx, "Error parsing speech speed", "error", err)
 			return
 		}
-		log.Println("Speech speed: ", speechSpeed)
+		slog.DebugContext(ctx, "Speech speed", "speed", speechSpeed)
 
-		speechSpeedValues := getSpeechSpeedValues()
-		if speechSpeedText, ok := speechSpeedValues[speechSpeed]; ok {
-			log.Printf("Setting speech speed to %.1f", speechSpeed)
+		if speechSpeedText, ok := speechSpeedLabel(gptConfig.SpeechSpeeds, speechSpeed); ok {
+			slog.InfoContext(ctx, "Setting speech speed", "speed", speechSpeed)
 			msg := tgbotapi.NewEditMessageText(callbackQuery.Message.Chat.ID,
 				callbackQuery.Message.MessageID,
 				fmt.Sprintf("You picked %s speech speed. The speech speed will be applied to the next pronunciation.", speechSpeedText))
-			_, err = bot.Send(msg)
+			_, err = send(ctx, bot, msg)
 			if err != nil {
-				log.Printf("Error sending confirmation message: %v\n", err)
+				slog.ErrorContext(ctx, "Error sending confirmation message", "error", err)
 			}
 			userId := int(callbackQuery.From.ID)
 
 			// send the Nth example
-			err = storage.UpdateUserSpeechSpeed(db, userId, speechSpeed)
+			err = storage.UpdateUserSpeechSpeed(ctx, db, userId, speechSpeed)
 			if err != nil {
-				log.Printf("Error updating user speech speed: %v\n", err)
+				slog.ErrorContext(ctx, "Error updating user speech speed", "error", err)
 				return
 			}
 		}
 	}
 }
 
-func sendLastRequestAudio(db *sql.DB, userId int, exampleNumber int, message string, openaiClient *openai.Client, bot *tgbotapi.BotAPI) bool {
-	lastQuery, err := storage.GetLastUserQuery(db, userId)
+func sendLastRequestAudio(ctx context.Context, db *sql.DB, userId int, exampleNumber int, message string, openaiClient *openai.Client, bot *tgbotapi.BotAPI, gptConfig *config.Config) bool {
+	lastQuery, err := storage.GetLastUserQuery(ctx, db, userId)
 	if err != nil {
-		log.Printf("Error getting last query: %v\n", err)
+		slog.ErrorContext(ctx, "Error getting last query", "error", err)
 		return true
 	}
-	log.Println(lastQuery)
-	lastResponse, err := storage.GetCachedResponseByWordLangAndType(db, lastQuery.Language, lastQuery.Type, lastQuery.Word)
+	slog.DebugContext(ctx, "Last query", "word", logging.Redact(lastQuery.Word), "help_type", lastQuery.Type, "language", lastQuery.Language)
+	level, err := storage.GetUserLevel(ctx, db, userId, lastQuery.Language)
+	if err != nil {
+		slog.WarnContext(ctx, "Error getting user level", "error", err)
+	}
+	lastResponse, err := storage.GetCachedResponseByWordLangAndType(ctx, db, lastQuery.Language, lastQuery.Type, lastQuery.Word, level)
 
 	if err != nil {
-		log.Printf("Error getting cached response: %v\n", err)
+		slog.ErrorContext(ctx, "Error getting cached response", "error", err)
 		return true
 	}
 
+	// answers cached before they were structured are parsed from the text
+	var structured *answer.Answer
+	if content, err := storage.GetCachedStructuredResponse(ctx, db, lastQuery.Language, lastQuery.Type, lastQuery.Word, level); err != nil {
+		slog.WarnContext(ctx, "Error getting structured response", "error", err)
+	} else if content != "" {
+		if structured, err = answer.Parse(content); err != nil {
+			slog.WarnContext(ctx, "Error parsing structured response", "error", err)
+		}
+	}
+
 	if lastQuery.Type == "examples" {
-		examples := parseExamplesByNumber(lastResponse)
-		log.Printf("Examples: %d\n", len(examples))
+		var examples []string
+		if structured != nil {
+			examples = structured.ExampleTexts()
+		} else {
+			examples = parseExamplesByNumber(lastResponse)
+		}
+		slog.DebugContext(ctx, "Parsed examples", "count", len(examples))
 
 		if exampleNumber == 0 && len(examples) > 0 {
 			// draw the inline keyboard with the examples
-			err := sendExamplesSelection(bot, int64(userId), len(examples))
+			err := sendExamplesSelection(ctx, bot, int64(userId), len(examples))
 			if err != nil {
-				log.Printf("Error sending examples selection: %v\n", err)
+				slog.ErrorContext(ctx, "Error sending examples selection", "error", err)
 				return true
 			}
 		} else if len(examples) >= exampleNumber || len(examples) == 0 {
@@ -251,116 +487,100 @@ func sendLastRequestAudio(db *sql.DB, userId int, exampleNumber int, message str
 			} else {
 				pronunciationString = examples[exampleNumber-1]
 			}
-			err := sendAudioMessage(openaiClient, db, pronunciationString, userId, bot)
+			err := sendAudioMessage(ctx, openaiClient, db, pronunciationString, userId, bot, gptConfig.TTSConfig)
 			if err != nil {
-				log.Printf("Error sending audio message: %v\n", err)
+				slog.ErrorContext(ctx, "Error sending audio message", "error", err)
 				return true
 			}
 		}
-	} else if lastQuery.Type == "translation" {
-		lastResponseLines := strings.Split(lastResponse, "\n")
-		if len(lastResponseLines) > 0 {
-			firstLine := lastResponseLines[0]
-			log.Printf("First line: %s\n", firstLine)
+	} else if lastQuery.Type == "translation" || lastQuery.Type == "inflection" {
+		headword := ""
+		if structured != nil {
+			headword = structured.Headword
+		} else if lastQuery.Type == "translation" {
+			headword = strings.Split(lastResponse, "\n")[0]
+		}
+		if headword != "" {
+			slog.DebugContext(ctx, "Pronouncing headword", "text", logging.Redact(headword))
 
-			err := sendAudioMessage(openaiClient, db, firstLine, userId, bot)
+			err := sendAudioMessage(ctx, openaiClient, db, headword, userId, bot, gptConfig.TTSConfig)
 			if err != nil {
-				log.Printf("Error sending audio message: %v\n", err)
+				slog.ErrorContext(ctx, "Error sending audio message", "error", err)
 				return true
 			}
 		}
-	} else {
-		// examples count is 0?
 	}
 	return false
 }
 
-func sendLanguageSelection(bot *tgbotapi.BotAPI, chatID int64) error {
+func sendLanguageSelection(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64) error {
 	msg := tgbotapi.NewMessage(chatID, "Please choose a language you want help learning:")
 	msg.ReplyMarkup = languageInlineKeyboard()
-	_, err := bot.Send(msg)
+	_, err := send(ctx, bot, msg)
 	if err != nil {
-		log.Printf("Error sending language selection: %v\n", err)
+		slog.ErrorContext(ctx, "Error sending language selection", "error", err)
 		return err
 	}
 	return nil
 }
 
-func sendSpeechSpeedSelection(bot *tgbotapi.BotAPI, chatID int64) error {
+func sendSpeechSpeedSelection(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, speeds []config.SpeechSpeed) error {
 	msg := tgbotapi.NewMessage(chatID, "Please choose a speech speed:")
-	msg.ReplyMarkup = speechSpeedInlineKeyboard()
-	_, err := bot.Send(msg)
+	msg.ReplyMarkup = speechSpeedInlineKeyboard(speeds)
+	_, err := send(ctx, bot, msg)
 	if err != nil {
-		log.Printf("Error sending speech speed selection: %v\n", err)
+		slog.ErrorContext(ctx, "Error sending speech speed selection", "error", err)
 		return err
 	}
 	return nil
 }
 
-func sendExamplesSelection(bot *tgbotapi.BotAPI, chatID int64, total int) error {
+func sendExamplesSelection(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, total int) error {
 	msg := tgbotapi.NewMessage(chatID, "Please choose an example:")
 	msg.ReplyMarkup = examplesInlineKeyboard(total)
-	_, err := bot.Send(msg)
+	_, err := send(ctx, bot, msg)
 	if err != nil {
-		log.Printf("Error sending examples selection: %v\n", err)
+		slog.ErrorContext(ctx, "Error sending examples selection", "error", err)
 		return err
 	}
 	return nil
 }
 
-func getSpeechSpeedValues() map[float64]string {
-	speedValues := map[float64]string{
-		0.5: "Slow",
-		0.7: "Normal",
-		1.0: "Fast",
-	}
-
-	keys := make([]float64, 0, len(speedValues))
-	for k := range speedValues {
-		keys = append(keys, k)
-	}
-
-	sort.Float64s(keys)
-
-	sortedMap := make(map[float64]string)
-	for _, k := range keys {
-		sortedMap[k] = speedValues[k]
+// speechSpeedLabel returns the label of the configured speech speed with the given value
+func speechSpeedLabel(speeds []config.SpeechSpeed, value float64) (string, bool) {
+	for _, speed := range speeds {
+		if speed.Value == value {
+			return speed.Label, true
+		}
 	}
-
-	return sortedMap
+	return "", false
 }
 
-// speechSpeedInlineKeyboard returns an inline keyboard with speech speed options
-// The following options are available:
-// - Slow - 0.5
-// - Normal - 0.7
-// - Fast - 1.0
+// speechSpeedInlineKeyboard returns an inline keyboard with the configured
+// speech speed options, e.g. Slow - 0.5, Normal - 0.7 and Fast - 1.0.
 // User is presented the text options
-func speechSpeedInlineKeyboard() tgbotapi.InlineKeyboardMarkup {
+func speechSpeedInlineKeyboard(speeds []config.SpeechSpeed) tgbotapi.InlineKeyboardMarkup {
 	keyboard := tgbotapi.NewInlineKeyboardMarkup()
 	currentInlineRow := tgbotapi.NewInlineKeyboardRow()
 
-	speechSpeedValues := getSpeechSpeedValues()
-	for speechSpeed, speechSpeedText := range speechSpeedValues {
-		currentInlineRow = append(currentInlineRow, tgbotapi.NewInlineKeyboardButtonData(speechSpeedText, fmt.Sprintf("speech_speed:%.1f", speechSpeed)))
+	for _, speed := range speeds {
+		currentInlineRow = append(currentInlineRow, tgbotapi.NewInlineKeyboardButtonData(speed.Label, fmt.Sprintf("speech_speed:%g", speed.Value)))
 	}
 	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, currentInlineRow)
 	return keyboard
 }
 
+// languageInlineKeyboard returns an inline keyboard with the supported
+// languages, three per row
 func languageInlineKeyboard() tgbotapi.InlineKeyboardMarkup {
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Dutch", "language:Dutch"),
-			tgbotapi.NewInlineKeyboardButtonData("French", "language:French"),
-			tgbotapi.NewInlineKeyboardButtonData("German", "language:German"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Estonian", "language:Estonian"),
-			tgbotapi.NewInlineKeyboardButtonData("Spanish", "language:Spanish"),
-			tgbotapi.NewInlineKeyboardButtonData("Russian", "language:Russian"),
-		),
-	)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup()
+	for start := 0; start < len(supportedLanguages); start += 3 {
+		row := tgbotapi.NewInlineKeyboardRow()
+		for _, language := range supportedLanguages[start:min(start+3, len(supportedLanguages))] {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(language, "language:"+language))
+		}
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+	}
 	return keyboard
 }
 
@@ -384,84 +604,133 @@ func examplesInlineKeyboard(total int) tgbotapi.InlineKeyboardMarkup {
 	return keyboard
 }
 
-func updateLanguagePreference(bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, language string, speech_speed float64) {
+func updateLanguagePreference(ctx context.Context, bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, language string, speech_speed float64) {
 	userID := int(callbackQuery.From.ID)
-	err := storage.UpdateUserLanguage(db, userID, language)
+	err := storage.UpdateUserLanguage(ctx, db, userID, language)
 	if err != nil {
 		// Handle error
-		log.Printf("Error updating language preference: %v\n", err)
+		slog.ErrorContext(ctx, "Error updating language preference", "error", err)
 		return
 	}
 
 	responseMsg := "Great, you picked %s. If you start typing words or phrases, I will send you a few examples with that word or a phrase. " +
 		"If you type a whole sentence, then that sentence will be translated to %s. " +
 		"You can also pick translation, where I will translate supplied phrase either from English to the language you picked, or the other way around. " +
+		"To learn more languages at once, add them with /lang and switch between them there. " +
 		"Enjoy!"
 
 	processedResponseMsg := fmt.Sprintf(responseMsg, language, language)
 	// Send a confirmation message and remove the inline keyboard
 	msg := tgbotapi.NewEditMessageText(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, processedResponseMsg)
 	// msg.ReplyMarkup = &emptyKeyboard
-	_, err = bot.Send(msg)
+	_, err = send(ctx, bot, msg)
 	if err != nil {
-		log.Printf("Error sending confirmation message: %v\n", err)
+		slog.ErrorContext(ctx, "Error sending confirmation message", "error", err)
 	}
 }
 
 type GptTemplateData struct {
 	Language    string
 	MessageText string
+	// Scenario and Difficulty are only set in the conversation practice mode
+	Scenario   string
+	Difficulty string
+	// Weaknesses lists the most frequent mistakes, only set for /practice
+	Weaknesses string
+	// Level is the CEFR level of the user, e.g. B1, if it is known
+	Level string
 }
 
-func HandleMessage(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, openaiClient *openai.Client, db *sql.DB) {
+func HandleMessage(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, openaiClient *openai.Client, db *sql.DB, gptConfig *config.Config) {
 	userID := int(message.From.ID)
-	language, err := storage.GetUserLanguage(db, userID)
+	language, err := storage.GetUserLanguage(ctx, db, userID)
 	if err != nil {
 		// Handle error
-		log.Printf("Error getting user language: %v\n", err)
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
 		return
 	}
 
-	helpType, err := GetUserHelpType(db, userID)
+	helpType, err := GetUserHelpType(ctx, db, userID)
 	if err != nil {
 		return
 	}
+	ctx = logging.WithHelpType(ctx, helpType)
+
+	if message.Document != nil {
+		if err := handleDocument(ctx, bot, message, openaiClient, db, gptConfig); err != nil {
+			slog.ErrorContext(ctx, "Error handling document", "error", err)
+		}
+		return
+	}
+
 	// send thinking message while the api is processing the request
-	thinkMsgResponse, shouldReturn := sendThinkingMessage(message, bot)
+	thinkMsgResponse, shouldReturn := sendThinkingMessage(ctx, message, bot)
 	if shouldReturn {
 		return
 	}
-	defer deleteThinkingMessage(message, thinkMsgResponse, bot)
+	defer deleteThinkingMessage(ctx, message, thinkMsgResponse, bot)
 
-	gptresponse, err := ProcessQuery(helpType, language, message.Text, db, userID, openaiClient)
+	var gptresponse string
+	parseMode := ""
+	switch helpType {
+	case "chat":
+		gptresponse, err = ProcessChatMessage(ctx, gptConfig, language, message.Text, db, userID, openaiClient)
+	case "correct":
+		gptresponse, err = ProcessCorrection(ctx, gptConfig, language, message.Text, db, userID, openaiClient)
+		parseMode = tgbotapi.ModeHTML
+	case "drill":
+		gptresponse, err = ProcessDrillAnswer(ctx, language, message.Text, db, userID)
+	case "cloze":
+		gptresponse, err = ProcessClozeAnswer(ctx, language, message.Text, db, userID)
+	case "dictation":
+		// the result and the next voice note are sent by the handler
+		if err := handleDictationAnswer(ctx, bot, message, db, openaiClient, gptConfig, language); err != nil {
+			slog.ErrorContext(ctx, "Error processing dictation", "error", err)
+		}
+		return
+	case "placement":
+		// the result and the next question are sent by the handler
+		if err := handlePlacementAnswer(ctx, bot, message, db, openaiClient, gptConfig); err != nil {
+			slog.ErrorContext(ctx, "Error processing placement answer", "error", err)
+		}
+		return
+	default:
+		// words may be in any of the languages the user learns
+		lookupLanguage := detectLanguage(ctx, db, openaiClient, gptConfig, userID, language, message.Text)
+		gptresponse, err = ProcessQuery(ctx, gptConfig, helpType, lookupLanguage, message.Text, db, userID, openaiClient)
+		if err == nil && lookupLanguage != language {
+			gptresponse = fmt.Sprintf("(%s)\n%s", lookupLanguage, gptresponse)
+		}
+	}
 	if err != nil {
-		log.Printf("Error processing query: %v\n", err)
+		slog.ErrorContext(ctx, "Error processing query", "error", err)
 		return
 	}
 
 	msg := tgbotapi.NewMessage(message.Chat.ID, gptresponse)
-	_, err = bot.Send(msg)
+	msg.ParseMode = parseMode
+	_, err = send(ctx, bot, msg)
 	if err != nil {
-		log.Printf("Error sending GPT response: %v\n", err)
+		slog.ErrorContext(ctx, "Error sending GPT response", "error", err)
 	}
 }
 
-func deleteThinkingMessage(message *tgbotapi.Message, thinkMsgResponse tgbotapi.Message, bot *tgbotapi.BotAPI) {
+func deleteThinkingMessage(ctx context.Context, message *tgbotapi.Message, thinkMsgResponse tgbotapi.Message, bot *tgbotapi.BotAPI) {
 	deleteMsg := tgbotapi.NewDeleteMessage(message.Chat.ID, thinkMsgResponse.MessageID)
-	response, err := bot.Request(deleteMsg)
+	response, err := request(ctx, bot, deleteMsg)
 	if err != nil {
-		log.Printf("Error deleting thinking message: %v\n", err)
+		slog.ErrorContext(ctx, "Error deleting thinking message", "error", err)
 	}
 	if string(response.Result) != "true" {
-		log.Printf("response is not true from deleteThinkingMessage")
+		slog.WarnContext(ctx, "response is not true from deleteThinkingMessage")
 	}
 }
 
-func sendThinkingMessage(message *tgbotapi.Message, bot *tgbotapi.BotAPI) (tgbotapi.Message, bool) {
+func sendThinkingMessage(ctx context.Context, message *tgbotapi.Message, bot *tgbotapi.BotAPI) (tgbotapi.Message, bool) {
 	thinkMsg := tgbotapi.NewMessage(message.Chat.ID, "Thinking...")
-	thinkMsgResponse, err := bot.Send(thinkMsg)
+	thinkMsgResponse, err := send(ctx, bot, thinkMsg)
 	if err != nil {
-		log.Printf("Error sending thinking message: %v\n", err)
+		slog.ErrorContext(ctx, "Error sending thinking message", "error", err)
 		return tgbotapi.Message{}, true
 	}
 	return thinkMsgResponse, false
@@ -473,6 +742,7 @@ func sendThinkingMessage(message *tgbotapi.Message, bot *tgbotapi.BotAPI) (tgbot
 // The generated response is then cached for future use.
 //
 // Parameters:
+// - gptConfig: The prompt templates and tunings to use.
 // - helpType: The type of help requested (e.g., "examples", "translation").
 // - language: The language of the query.
 // - message: The query message.
@@ -483,31 +753,103 @@ func sendThinkingMessage(message *tgbotapi.Message, bot *tgbotapi.BotAPI) (tgbot
 // Returns:
 // - string: The generated response or the cached response.
 // - error: An error if any occurred during the process.
-func ProcessQuery(helpType string, language string, message string, db *sql.DB, userID int, openaiClient *openai.Client) (string, error) {
-	gptConfig := config.NewConfig()
+func ProcessQuery(ctx context.Context, gptConfig *config.Config, helpType string, language string, message string, db *sql.DB, userID int, openaiClient *openai.Client) (response string, err error) {
+	ctx, span := tracing.Start(ctx, "bot.ProcessQuery",
+		attribute.String("help_type", helpType),
+		attribute.String("language", language),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	if message == "" {
 		return "", errors.New("message is empty")
 	}
+	metrics.HelpTypeRequestsTotal.WithLabelValues(helpType).Inc()
+	ctx = logging.WithHelpType(ctx, helpType)
 	// check if we can find cached response
-	log.Printf("Checking cache for response: language=%s, type=%s, word=%s\n", language, helpType, message)
+	slog.DebugContext(ctx, "Checking cache for response", "language", language, "word", logging.Redact(message))
 
-	cachedResponse, err := storage.GetCachedResponseByWordLangAndType(db, language, helpType, message)
+	// responses are written for the level of the user, if it is known
+	level, err := storage.GetUserLevel(ctx, db, userID, language)
 	if err != nil {
-		log.Printf("Error getting cached response: %v\n", err)
+		slog.WarnContext(ctx, "Error getting user level", "error", err)
+		level = ""
+	}
+	cachedResponse, err := storage.GetCachedResponseByWordLangAndType(ctx, db, language, helpType, message, level)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting cached response", "error", err)
 		return "", err
 	}
 
 	if cachedResponse != "" {
-		log.Printf("Found cached response")
+		metrics.CacheRequestsTotal.WithLabelValues("hit").Inc()
+		slog.DebugContext(ctx, "Found cached response")
 		// store query
-		log.Printf("Storing query: userID=%d, message=%s\n", userID, message)
-		_, err := storage.StoreQuery(db, userID, helpType, language, message)
+		slog.DebugContext(ctx, "Storing query", "word", logging.Redact(message))
+		_, err := storage.StoreQuery(ctx, db, userID, helpType, language, message)
 		if err != nil {
-			log.Printf("Error storing query: %v\n", err)
+			slog.ErrorContext(ctx, "Error storing query", "error", err)
 		}
 		return cachedResponse, nil
 	}
 
+	metrics.CacheRequestsTotal.WithLabelValues("miss").Inc()
+
+	gptRequest, metadata, err := BuildGPTRequest(gptConfig, helpType, language, level, message)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error building GPT request", "error", err)
+		return "", err
+	}
+	span.SetAttributes(attribute.String("prompt.version", metadata.Version))
+
+	slog.DebugContext(ctx, "Storing query", "word", logging.Redact(message))
+	query_id, err := storage.StoreQuery(ctx, db, userID, helpType, language, message)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error storing query", "error", err)
+	}
+
+	gptresponse, err := openai_api.GetGPTResponse(ctx, openaiClient, gptRequest)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting GPT response", "error", err)
+		return "", err
+	}
+
+	// render the structured answer, falling back to the raw text if the
+	// model did not follow the schema
+	rendered := gptresponse
+	structured, err := answer.Parse(gptresponse)
+	if err != nil {
+		slog.WarnContext(ctx, "Error parsing structured answer", "error", err)
+	} else {
+		rendered = structured.Render()
+	}
+
+	// cache response
+	slog.DebugContext(ctx, "Caching response", "language", language, "word", logging.Redact(message))
+	err = storage.CacheResponse(ctx, db, query_id, rendered)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error caching response", "error", err)
+		return "", err
+	}
+	if level != "" {
+		err = storage.CacheResponseLevel(ctx, db, query_id, level)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error caching response level", "error", err)
+		}
+	}
+	if structured != nil {
+		err = storage.CacheStructuredResponse(ctx, db, query_id, gptresponse)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error caching structured response", "error", err)
+		}
+	}
+	return rendered, nil
+}
+
+// BuildGPTRequest renders the prompt template of the help type for the CEFR
+// level, if known, and combines it with the tuning of the language into a
+// request for the message. The tuning metadata is returned alongside, e.g.
+// for its prompt version.
+func BuildGPTRequest(gptConfig *config.Config, helpType, language, level, message string) (openai_api.GPTRequest, config.TuningMetadata, error) {
 	var gpt *config.GptRequestType
 	switch helpType {
 	case "examples":
@@ -517,66 +859,53 @@ func ProcessQuery(helpType string, language string, message string, db *sql.DB,
 	case "inflection":
 		gpt = gptConfig.GptTemplateInflection
 	default:
-		log.Printf("invalid help type: %s\n", helpType)
-		return "", errors.New("invalid help type")
+		return openai_api.GPTRequest{}, config.TuningMetadata{}, fmt.Errorf("invalid help type: %s", helpType)
 	}
 
 	data := GptTemplateData{
 		Language:    language,
 		MessageText: message,
+		Level:       level,
 	}
 
 	var gptPrompt strings.Builder
-	err = gpt.PromptTemplate.Execute(&gptPrompt, data)
+	err := gpt.PromptTemplate.Execute(&gptPrompt, data)
 	if err != nil {
-		log.Printf("Error executing GPT template: %v\n", err)
-		return "", err
+		return openai_api.GPTRequest{}, config.TuningMetadata{}, err
 	}
 
-	// log storing query: userID, message
-	log.Printf("Storing query: %d, %s\n", userID, message)
-	query_id, err := storage.StoreQuery(db, userID, helpType, language, message)
-	if err != nil {
-		log.Printf("Error storing query: %v\n", err)
+	tuning := gptConfig.GptPromptTunings[language][helpType]
+	model := gptConfig.ChatModel
+	if tuning.Metadata.Model != "" {
+		model = tuning.Metadata.Model
 	}
 
 	gptRequest := openai_api.GPTRequest{
+		Model:                  model,
+		Temperature:            tuning.Metadata.Temperature,
+		MaxTokens:              tuning.Metadata.MaxTokens,
 		Prompt:                 gptPrompt.String(),
 		WordOrPhrase:           message,
-		ChatCompletionMessages: gptConfig.GptPromptTunings[language][helpType].Messages,
-	}
-
-	ctx := context.Background()
-
-	gptresponse, err := openai_api.GetGPTResponse(ctx, openaiClient, gptRequest)
-	if err != nil {
-		log.Printf("Error getting GPT response: %v\n", err)
-		return "", err
-	}
-
-	// cache response
-	log.Printf("Caching response: language=%s, type=%s, word=%s\n", language, helpType, message)
-	err = storage.CacheResponse(db, query_id, gptresponse)
-	if err != nil {
-		log.Printf("Error caching response: %v\n", err)
-		return "", err
+		ChatCompletionMessages: tuning.Messages,
+		Schema:                 answer.Schema,
+		SchemaName:             answer.SchemaName,
 	}
-	return gptresponse, nil
+	return gptRequest, tuning.Metadata, nil
 }
 
-func GetUserHelpType(db *sql.DB, userID int) (string, error) {
-	helpType, err := storage.GetUserHelpType(db, userID)
+func GetUserHelpType(ctx context.Context, db *sql.DB, userID int) (string, error) {
+	helpType, err := storage.GetUserHelpType(ctx, db, userID)
 	if err != nil {
 
-		log.Printf("Error getting user help_type: %v\n", err)
+		slog.ErrorContext(ctx, "Error getting user help_type", "error", err)
 		return "", err
 	}
 	if helpType == "" {
 		helpType = "translation"
-		err = storage.UpdateUserHelpType(db, userID, helpType)
+		err = storage.UpdateUserHelpType(ctx, db, userID, helpType)
 		if err != nil {
 
-			log.Printf("Error updating user help_type: %v\n", err)
+			slog.ErrorContext(ctx, "Error updating user help_type", "error", err)
 			return "", err
 		}
 	}
@@ -0,0 +1,190 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"language-learning-bot/pkg/config"
+	storage "language-learning-bot/pkg/storage"
+	"language-learning-bot/pkg/wordlist"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// importMaxFileSize is the largest document accepted for an import
+	importMaxFileSize = 1 << 20
+	// importMaxWords is the most words imported from one document
+	importMaxWords = 500
+	// importCaption is the caption that marks a document as a list to import
+	importCaption = "/import"
+)
+
+// ImportResult counts what happened to the words of an imported list
+type ImportResult struct {
+	Added      int
+	Existing   int
+	Translated int
+	Failed     int
+	// Unsupported counts the words in languages the bot does not support
+	Unsupported int
+	// Languages are the languages words were saved in
+	Languages []string
+}
+
+// ImportWords saves the words to the vocabulary of the user in their own
+// language, for lists with a language column, or else in the language.
+// If translate is set, each word is looked up in translation mode first, so
+// that its translation is cached and the saved word links to the lookup.
+func ImportWords(ctx context.Context, gptConfig *config.Config, db *sql.DB, openaiClient *openai.Client, userID int, language string, entries []wordlist.Entry, translate bool) (ImportResult, error) {
+	var result ImportResult
+	for _, entry := range entries {
+		entryLanguage := language
+		if entry.Language != "" {
+			var ok bool
+			if entryLanguage, ok = supportedLanguage(entry.Language); !ok {
+				result.Unsupported++
+				continue
+			}
+		}
+		if !slices.Contains(result.Languages, entryLanguage) {
+			result.Languages = append(result.Languages, entryLanguage)
+		}
+
+		if translate {
+			if _, err := ProcessQuery(ctx, gptConfig, "translation", entryLanguage, entry.Word, db, userID, openaiClient); err != nil {
+				slog.WarnContext(ctx, "Error translating imported word", "error", err)
+				result.Failed++
+			} else {
+				result.Translated++
+			}
+		}
+		added, err := storage.SaveWord(ctx, db, userID, entryLanguage, entry.Word, entry.Tags)
+		if err != nil {
+			return result, err
+		}
+		if added {
+			result.Added++
+		} else {
+			result.Existing++
+		}
+	}
+	return result, nil
+}
+
+// String summarizes the result for the user
+func (r ImportResult) String() string {
+	summary := fmt.Sprintf("%d new words", r.Added)
+	if r.Existing > 0 {
+		summary += fmt.Sprintf(", %d already saved", r.Existing)
+	}
+	if r.Translated > 0 || r.Failed > 0 {
+		summary += fmt.Sprintf(", %d translated", r.Translated)
+	}
+	if r.Failed > 0 {
+		summary += fmt.Sprintf(", %d could not be translated", r.Failed)
+	}
+	if r.Unsupported > 0 {
+		summary += fmt.Sprintf(", %d skipped in languages other than %s", r.Unsupported, strings.Join(supportedLanguages, ", "))
+	}
+	return summary
+}
+
+func handleImportCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) error {
+	text := "Send a word list as a file with the caption /import to add it to your words. " +
+		"CSV, TSV, plain text with a word per line and JSON files are supported; a header row may name the word and tags columns. " +
+		"Use the caption /import translate to also look up the translation of every word."
+	_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+	return err
+}
+
+// handleDocument imports documents sent with the /import caption and looks
+// up the words of any other document, compiling the responses in a CSV file
+// if the caption is "csv"
+func handleDocument(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, openaiClient *openai.Client, db *sql.DB, gptConfig *config.Config) error {
+	caption := strings.Fields(strings.ToLower(message.Caption))
+	if len(caption) == 0 || caption[0] != importCaption {
+		asCSV := len(caption) > 0 && caption[0] == "csv"
+		return lookupDocument(ctx, bot, message, openaiClient, db, gptConfig, asCSV)
+	}
+	translate := len(caption) > 1 && caption[1] == "translate"
+	return importDocument(ctx, bot, message, openaiClient, db, gptConfig, translate)
+}
+
+func importDocument(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, openaiClient *openai.Client, db *sql.DB, gptConfig *config.Config, translate bool) error {
+	userID := int(message.From.ID)
+	language, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
+		return err
+	}
+
+	content, err := downloadDocument(ctx, bot, message.Document)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error downloading document", "error", err)
+		_, sendErr := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Could not read the file: %s", err)))
+		return sendErr
+	}
+	entries, err := wordlist.Parse(message.Document.FileName, content)
+	if err != nil {
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Could not read the word list: %s", err)))
+		return err
+	}
+	if len(entries) == 0 {
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, "The file has no words."))
+		return err
+	}
+	if len(entries) > importMaxWords {
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("The file has %d words, please send at most %d at a time.", len(entries), importMaxWords)))
+		return err
+	}
+
+	if translate {
+		text := fmt.Sprintf("Importing %d words and looking up their translations, this may take a while...", len(entries))
+		if _, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text)); err != nil {
+			slog.ErrorContext(ctx, "Error sending import progress", "error", err)
+		}
+	}
+	result, err := ImportWords(ctx, gptConfig, db, openaiClient, userID, language, entries, translate)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error importing words", "error", err)
+		return err
+	}
+	text := fmt.Sprintf("Imported the words: %s. See them with /words.", result)
+	if len(result.Languages) > 0 {
+		text = fmt.Sprintf("Imported the %s words: %s. See them with /words.", strings.Join(result.Languages, " and "), result)
+	}
+	_, err = send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+	return err
+}
+
+// downloadDocument returns the content of a document sent to the bot
+func downloadDocument(ctx context.Context, bot *tgbotapi.BotAPI, document *tgbotapi.Document) ([]byte, error) {
+	if document.FileSize > importMaxFileSize {
+		return nil, fmt.Errorf("the file is larger than %d KB", importMaxFileSize>>10)
+	}
+	url, err := bot.GetFileDirectURL(document.FileID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading the file: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, importMaxFileSize))
+}
@@ -0,0 +1,252 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"language-learning-bot/pkg/answer"
+	"language-learning-bot/pkg/config"
+	openai_api "language-learning-bot/pkg/openai"
+	storage "language-learning-bot/pkg/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashabaranov/go-openai"
+)
+
+// supportedLanguages are the languages users can pick, in the order of the
+// language keyboard
+var supportedLanguages = []string{"Dutch", "French", "German", "Estonian", "Spanish", "Russian"}
+
+// supportedLanguage returns the supported language with the name in any case
+func supportedLanguage(name string) (string, bool) {
+	for _, language := range supportedLanguages {
+		if strings.EqualFold(language, name) {
+			return language, true
+		}
+	}
+	return "", false
+}
+
+// handleLangCommand switches to the language given, e.g. "/lang German",
+// adding it to the user's languages if it is new, removes one with
+// "/lang remove German" or shows a keyboard of the user's languages
+func handleLangCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB) error {
+	userID := int(message.From.ID)
+	arguments := strings.Fields(message.CommandArguments())
+	usage := fmt.Sprintf("Send /lang to pick one of your languages, /lang with one of %s to switch to it or /lang remove with one of your languages.",
+		strings.Join(supportedLanguages, ", "))
+
+	switch {
+	case len(arguments) == 0:
+		return sendUserLanguages(ctx, bot, message.Chat.ID, db, userID)
+
+	case len(arguments) == 2 && strings.EqualFold(arguments[0], "remove"):
+		language, ok := supportedLanguage(arguments[1])
+		if !ok {
+			_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, usage))
+			return err
+		}
+		removed, err := storage.RemoveUserLanguage(ctx, db, userID, language)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error removing user language", "error", err)
+			return err
+		}
+		text := fmt.Sprintf("Removed %s from your languages. Your words and history are kept if you add it again.", language)
+		if !removed {
+			text = fmt.Sprintf("%s is not one of your languages or the one you are learning now; switch to another language first.", language)
+		}
+		_, err = send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+		return err
+
+	case len(arguments) == 1:
+		language, ok := supportedLanguage(arguments[0])
+		if !ok {
+			_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, usage))
+			return err
+		}
+		text, err := switchLanguage(ctx, db, userID, language)
+		if err != nil {
+			return err
+		}
+		_, err = send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+		return err
+	}
+
+	_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, usage))
+	return err
+}
+
+// sendUserLanguages sends a keyboard with a button per language of the user
+// and one to add a language
+func sendUserLanguages(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, db *sql.DB, userID int) error {
+	languages, err := storage.GetUserLanguages(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user languages", "error", err)
+		return err
+	}
+	if len(languages) == 0 {
+		return sendLanguageSelection(ctx, bot, chatID)
+	}
+	active, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("You are learning %s. Switch to another of your languages or add one:", active))
+	msg.ReplyMarkup = userLanguagesInlineKeyboard(languages, active)
+	_, err = send(ctx, bot, msg)
+	return err
+}
+
+// userLanguagesInlineKeyboard returns an inline keyboard with the languages
+// of the user, the active one checked, and a button to add a language
+func userLanguagesInlineKeyboard(languages []string, active string) tgbotapi.InlineKeyboardMarkup {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup()
+	row := tgbotapi.NewInlineKeyboardRow()
+	for _, language := range languages {
+		label := language
+		if language == active {
+			label = "✓ " + language
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, "lang:"+language))
+		if len(row) == 3 {
+			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+			row = tgbotapi.NewInlineKeyboardRow()
+		}
+	}
+	if len(row) > 0 {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+	}
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ Add a language", "lang_add"),
+	))
+	return keyboard
+}
+
+// handleLangCallback switches to the picked language of the user or shows
+// the languages that can be added
+func handleLangCallback(ctx context.Context, bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, data string) {
+	chatID, messageID := callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID
+	if data == "lang_add" {
+		msg := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, "Please choose a language you want help learning:", languageInlineKeyboard())
+		if _, err := send(ctx, bot, msg); err != nil {
+			slog.ErrorContext(ctx, "Error sending language selection", "error", err)
+		}
+		return
+	}
+
+	language, ok := supportedLanguage(strings.TrimPrefix(data, "lang:"))
+	if !ok {
+		slog.ErrorContext(ctx, "Invalid language callback data", "data", data)
+		return
+	}
+	text, err := switchLanguage(ctx, db, int(callbackQuery.From.ID), language)
+	if err != nil {
+		return
+	}
+	if _, err := send(ctx, bot, tgbotapi.NewEditMessageText(chatID, messageID, text)); err != nil {
+		slog.ErrorContext(ctx, "Error sending language confirmation", "error", err)
+	}
+}
+
+// switchLanguage makes the language the active one of the user and returns
+// a confirmation with the mode and level the user has in it
+func switchLanguage(ctx context.Context, db *sql.DB, userID int, language string) (string, error) {
+	if err := storage.UpdateUserLanguage(ctx, db, userID, language); err != nil {
+		slog.ErrorContext(ctx, "Error updating language preference", "error", err)
+		return "", err
+	}
+	helpType, err := GetUserHelpType(ctx, db, userID)
+	if err != nil {
+		return "", err
+	}
+	level, err := storage.GetUserLevel(ctx, db, userID, language)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user level", "error", err)
+		return "", err
+	}
+
+	text := fmt.Sprintf("You are now learning %s, in %s mode.", language, helpType)
+	if level != "" {
+		text += fmt.Sprintf(" Your level is %s.", level)
+	} else {
+		text += " Send /level to find your level."
+	}
+	return text, nil
+}
+
+// detectLanguage returns which of the user's languages the text of a lookup
+// is written in: the language the user looked up or saved it in before, or
+// else the one the model detects. The active language is returned if the
+// user learns only one language, for English texts and if in doubt.
+func detectLanguage(ctx context.Context, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config, userID int, active, text string) string {
+	languages, err := storage.GetUserLanguages(ctx, db, userID)
+	if err != nil {
+		slog.WarnContext(ctx, "Error getting user languages", "error", err)
+		return active
+	}
+	if len(languages) < 2 {
+		return active
+	}
+
+	known, err := storage.GetWordLanguages(ctx, db, userID, strings.TrimSpace(text))
+	if err != nil {
+		slog.WarnContext(ctx, "Error getting word languages", "error", err)
+	}
+	if slices.Contains(known, active) {
+		return active
+	}
+	if len(known) == 1 {
+		return known[0]
+	}
+
+	gptRequest, err := BuildLanguageDetectionRequest(gptConfig, active, languages, text)
+	if err != nil {
+		slog.WarnContext(ctx, "Error building language detection request", "error", err)
+		return active
+	}
+	gptresponse, err := openai_api.GetGPTResponse(ctx, openaiClient, gptRequest)
+	if err != nil {
+		slog.WarnContext(ctx, "Error detecting language", "error", err)
+		return active
+	}
+	detected, err := answer.ParseDetectedLanguage(gptresponse)
+	if err != nil {
+		slog.WarnContext(ctx, "Error parsing detected language", "error", err)
+		return active
+	}
+	for _, language := range languages {
+		if strings.EqualFold(language, detected.Language) {
+			return language
+		}
+	}
+	return active
+}
+
+// BuildLanguageDetectionRequest renders the language detection prompt
+// template into a request listing the user's languages with the text
+func BuildLanguageDetectionRequest(gptConfig *config.Config, active string, languages []string, text string) (openai_api.GPTRequest, error) {
+	data := GptTemplateData{
+		Language:    active,
+		MessageText: text,
+	}
+
+	var gptPrompt strings.Builder
+	err := gptConfig.GptTemplateDetectLanguage.PromptTemplate.Execute(&gptPrompt, data)
+	if err != nil {
+		return openai_api.GPTRequest{}, err
+	}
+
+	return openai_api.GPTRequest{
+		Model:        gptConfig.ChatModel,
+		Prompt:       gptPrompt.String(),
+		WordOrPhrase: fmt.Sprintf("My languages: %s\nText: %s", strings.Join(languages, ", "), text),
+		Schema:       answer.DetectedLanguageSchema,
+		SchemaName:   answer.DetectedLanguageSchemaName,
+	}, nil
+}
@@ -0,0 +1,408 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"language-learning-bot/pkg/answer"
+	"language-learning-bot/pkg/config"
+	"language-learning-bot/pkg/metrics"
+	openai_api "language-learning-bot/pkg/openai"
+	storage "language-learning-bot/pkg/storage"
+	"language-learning-bot/pkg/textmatch"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashabaranov/go-openai"
+)
+
+// cefrLevels are the levels of the Common European Framework of Reference,
+// from the lowest
+var cefrLevels = []string{"A1", "A2", "B1", "B2", "C1", "C2"}
+
+const (
+	// placementQuestions is the number of questions of a placement test
+	placementQuestions = 8
+	// placementStartLevel is the index in cefrLevels of the first question
+	placementStartLevel = 2
+)
+
+// levelDifficulty returns the conversation difficulty matching the level of
+// the user in the language, the easiest one if the level is not known
+func levelDifficulty(ctx context.Context, db *sql.DB, userID int, language string) int {
+	level, err := storage.GetUserLevel(ctx, db, userID, language)
+	if err != nil {
+		slog.WarnContext(ctx, "Error getting user level", "error", err)
+		return 0
+	}
+	return cefrDifficulty(level)
+}
+
+// cefrDifficulty maps the levels to the conversation difficulties: A1-A2 to
+// beginner, B1-B2 to intermediate and C1-C2 to advanced
+func cefrDifficulty(level string) int {
+	index := slices.Index(cefrLevels, level)
+	if index < 0 {
+		return 0
+	}
+	return index * len(chatDifficulties) / len(cefrLevels)
+}
+
+// handleLevelCommand shows the level of the user, sets it to the level given,
+// e.g. "/level B1", or starts the placement test with "/level test" or if the
+// level is not known yet
+func handleLevelCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config) error {
+	userID := int(message.From.ID)
+	language, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
+		return err
+	}
+
+	argument := strings.ToUpper(strings.TrimSpace(message.CommandArguments()))
+	switch {
+	case argument == "TEST":
+		return startPlacementTest(ctx, bot, message.Chat.ID, db, openaiClient, gptConfig, userID, language)
+
+	case slices.Contains(cefrLevels, argument):
+		if err := storage.SetUserLevel(ctx, db, userID, language, argument); err != nil {
+			slog.ErrorContext(ctx, "Error setting user level", "error", err)
+			return err
+		}
+		resetChatDifficulty(ctx, db, userID, language, argument)
+		text := fmt.Sprintf("Your %s level is set to %s. Examples, translations and conversations are adapted to it.", language, argument)
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+		return err
+
+	case argument != "":
+		text := fmt.Sprintf("Send /level test to take the placement test or /level with one of %s to set your level.", strings.Join(cefrLevels, ", "))
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+		return err
+	}
+
+	level, err := storage.GetUserLevel(ctx, db, userID, language)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user level", "error", err)
+		return err
+	}
+	if level == "" {
+		return startPlacementTest(ctx, bot, message.Chat.ID, db, openaiClient, gptConfig, userID, language)
+	}
+	text := fmt.Sprintf("Your %s level is %s. Send /level test to take the placement test again or /level with one of %s to set it.",
+		language, level, strings.Join(cefrLevels, ", "))
+	_, err = send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+	return err
+}
+
+// resetChatDifficulty starts the conversation practice in the language over
+// at the difficulty of the level, if the user has chatted in it before
+func resetChatDifficulty(ctx context.Context, db *sql.DB, userID int, language, level string) {
+	session, err := storage.GetChatSession(ctx, db, userID, language)
+	if err != nil || session == nil {
+		return
+	}
+	session.Difficulty, session.CleanTurns, session.MistakeTurns = cefrDifficulty(level), 0, 0
+	if err := storage.UpdateChatSession(ctx, db, userID, language, session); err != nil {
+		slog.ErrorContext(ctx, "Error updating chat session", "error", err)
+	}
+}
+
+// startPlacementTest switches the user to the placement mode, so that short
+// answers are scored, and sends the first question
+func startPlacementTest(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config, userID int, language string) error {
+	previousHelpType, err := GetUserHelpType(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+	if previousHelpType == "placement" {
+		// a test was started again before the last one was finished
+		if test, err := storage.GetActivePlacementTest(ctx, db, userID); err == nil && test != nil {
+			previousHelpType = test.PreviousHelpType
+		} else {
+			previousHelpType = "translation"
+		}
+	}
+
+	testID, err := storage.StartPlacementTest(ctx, db, userID, language, previousHelpType)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error starting placement test", "error", err)
+		return err
+	}
+	if err := storage.UpdateUserHelpType(ctx, db, userID, "placement"); err != nil {
+		slog.ErrorContext(ctx, "Error updating user help_type", "error", err)
+		return err
+	}
+
+	text := fmt.Sprintf("Let's find your %s level! I will ask %d questions that get harder or easier with your answers. "+
+		"Pick an option or type a short answer.", language, placementQuestions)
+	if _, err := send(ctx, bot, tgbotapi.NewMessage(chatID, text)); err != nil {
+		slog.ErrorContext(ctx, "Error sending placement instructions", "error", err)
+		return err
+	}
+	test := &storage.PlacementTest{ID: testID, UserID: userID, Language: language, PreviousHelpType: previousHelpType}
+	return sendNextPlacementQuestion(ctx, bot, chatID, db, openaiClient, gptConfig, test, nil)
+}
+
+// nextPlacementLevel returns the index in cefrLevels of the next question:
+// a level up after a right answer and a level down after a wrong one
+func nextPlacementLevel(questions []storage.PlacementQuestion) int {
+	if len(questions) == 0 {
+		return placementStartLevel
+	}
+	last := questions[len(questions)-1]
+	index := slices.Index(cefrLevels, last.Level)
+	if last.Correct {
+		return min(index+1, len(cefrLevels)-1)
+	}
+	return max(index-1, 0)
+}
+
+// placementLevel returns the highest level with at least one right answer
+// and no more wrong than right answers, A1 if there is none
+func placementLevel(questions []storage.PlacementQuestion) string {
+	right := make(map[string]int)
+	wrong := make(map[string]int)
+	for _, question := range questions {
+		if question.Correct {
+			right[question.Level]++
+		} else {
+			wrong[question.Level]++
+		}
+	}
+	placed := cefrLevels[0]
+	for _, level := range cefrLevels {
+		if right[level] > 0 && right[level] >= wrong[level] {
+			placed = level
+		}
+	}
+	return placed
+}
+
+// sendNextPlacementQuestion generates a question at the level the answers so
+// far lead to, alternating multiple-choice and short answer questions
+func sendNextPlacementQuestion(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config, test *storage.PlacementTest, questions []storage.PlacementQuestion) error {
+	level := cefrLevels[nextPlacementLevel(questions)]
+	multipleChoice := len(questions)%2 == 0
+	asked := make([]string, len(questions))
+	for i, question := range questions {
+		asked[i] = question.Question
+	}
+
+	gptRequest, err := BuildPlacementRequest(gptConfig, test.Language, level, multipleChoice, asked)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error building placement request", "error", err)
+		return err
+	}
+	gptresponse, err := openai_api.GetGPTResponse(ctx, openaiClient, gptRequest)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting GPT response", "error", err)
+		return err
+	}
+	generated, err := answer.ParsePlacementQuestion(gptresponse)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error parsing placement question", "error", err)
+		return err
+	}
+	if !multipleChoice {
+		// the answer is typed, so options would only give it away
+		generated.Options = nil
+	}
+
+	question := &storage.PlacementQuestion{
+		TestID:       test.ID,
+		Level:        level,
+		Question:     generated.Question,
+		Options:      generated.Options,
+		Answer:       generated.Answer,
+		Alternatives: generated.Alternatives,
+		Explanation:  generated.Explanation,
+	}
+	if err := storage.AddPlacementQuestion(ctx, db, question); err != nil {
+		slog.ErrorContext(ctx, "Error storing placement question", "error", err)
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Question %d/%d\n%s", question.Position+1, placementQuestions, question.Question))
+	if len(question.Options) > 0 {
+		keyboard := tgbotapi.NewInlineKeyboardMarkup()
+		for i, option := range question.Options {
+			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(option, fmt.Sprintf("level:%d:%d", question.ID, i)),
+			))
+		}
+		msg.ReplyMarkup = keyboard
+	}
+	_, err = send(ctx, bot, msg)
+	return err
+}
+
+// BuildPlacementRequest renders the placement prompt template for the level
+// into a request for a multiple-choice or short answer question
+func BuildPlacementRequest(gptConfig *config.Config, language, level string, multipleChoice bool, asked []string) (openai_api.GPTRequest, error) {
+	data := GptTemplateData{
+		Language: language,
+		Level:    level,
+	}
+
+	var gptPrompt strings.Builder
+	err := gptConfig.GptTemplatePlacement.PromptTemplate.Execute(&gptPrompt, data)
+	if err != nil {
+		return openai_api.GPTRequest{}, err
+	}
+
+	message := "Write a question answered with one word or a short phrase, without options."
+	if multipleChoice {
+		message = "Write a multiple-choice question with four options."
+	}
+	if len(asked) > 0 {
+		message += " Already asked:\n" + strings.Join(asked, "\n")
+	}
+	return openai_api.GPTRequest{
+		Model:        gptConfig.ChatModel,
+		Prompt:       gptPrompt.String(),
+		WordOrPhrase: message,
+		Schema:       answer.PlacementSchema,
+		SchemaName:   answer.PlacementSchemaName,
+	}, nil
+}
+
+// handlePlacementCallback scores the option picked for a multiple-choice question
+func handlePlacementCallback(ctx context.Context, bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config, data string) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 {
+		slog.ErrorContext(ctx, "Invalid placement callback data", "data", data)
+		return
+	}
+	questionID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		slog.ErrorContext(ctx, "Error parsing placement question", "error", err)
+		return
+	}
+	chosen, err := strconv.Atoi(parts[2])
+	if err != nil {
+		slog.ErrorContext(ctx, "Error parsing placement option", "error", err)
+		return
+	}
+
+	userID := int(callbackQuery.From.ID)
+	question, err := storage.GetPlacementQuestion(ctx, db, userID, questionID)
+	if err != nil || question == nil || chosen < 0 || chosen >= len(question.Options) {
+		slog.ErrorContext(ctx, "Error getting placement question", "error", err, "question", questionID)
+		return
+	}
+	err = answerPlacementQuestion(ctx, bot, callbackQuery.Message.Chat.ID, db, openaiClient, gptConfig, userID, question, question.Options[chosen])
+	if err != nil {
+		slog.ErrorContext(ctx, "Error answering placement question", "error", err)
+	}
+}
+
+// handlePlacementAnswer scores a typed answer to the last question of the
+// placement test, or asks the next question if the last one was not sent
+func handlePlacementAnswer(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config) error {
+	metrics.HelpTypeRequestsTotal.WithLabelValues("placement").Inc()
+	userID := int(message.From.ID)
+
+	test, err := storage.GetActivePlacementTest(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting placement test", "error", err)
+		return err
+	}
+	if test == nil {
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, "There is no placement test running. Send /level test to start one."))
+		return err
+	}
+	questions, err := storage.GetPlacementQuestions(ctx, db, test.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting placement questions", "error", err)
+		return err
+	}
+	if len(questions) == 0 || questions[len(questions)-1].Answered {
+		return sendNextPlacementQuestion(ctx, bot, message.Chat.ID, db, openaiClient, gptConfig, test, questions)
+	}
+
+	question := &questions[len(questions)-1]
+	userAnswer := strings.TrimSpace(message.Text)
+	if len(question.Options) > 0 {
+		// options may be typed too, but only exactly
+		index := slices.IndexFunc(question.Options, func(option string) bool { return textmatch.Compare(userAnswer, option) == textmatch.Correct })
+		if index < 0 {
+			_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, "Please pick one of the options."))
+			return err
+		}
+		userAnswer = question.Options[index]
+	}
+	return answerPlacementQuestion(ctx, bot, message.Chat.ID, db, openaiClient, gptConfig, userID, question, userAnswer)
+}
+
+// answerPlacementQuestion stores the answer, sends whether it is right and
+// goes on with the next question or the result of the test
+func answerPlacementQuestion(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config, userID int, question *storage.PlacementQuestion, userAnswer string) error {
+	var correct bool
+	if len(question.Options) > 0 {
+		correct = userAnswer == question.Answer
+	} else {
+		correct = textmatch.CompareFuzzy(userAnswer, append([]string{question.Answer}, question.Alternatives...)...) != textmatch.Wrong
+	}
+	answered, err := storage.AnswerPlacementQuestion(ctx, db, question.ID, userAnswer, correct)
+	if err != nil {
+		return err
+	}
+	if !answered {
+		// the button was pressed twice
+		return nil
+	}
+
+	result := "✅ Correct!"
+	if !correct {
+		result = fmt.Sprintf("❌ It is «%s».", question.Answer)
+	}
+	if question.Explanation != "" {
+		result += " " + question.Explanation
+	}
+	if _, err := send(ctx, bot, tgbotapi.NewMessage(chatID, result)); err != nil {
+		slog.ErrorContext(ctx, "Error sending placement result", "error", err)
+	}
+
+	test, err := storage.GetActivePlacementTest(ctx, db, userID)
+	if err != nil || test == nil || test.ID != question.TestID {
+		// the test was finished or another one was started meanwhile
+		return err
+	}
+	questions, err := storage.GetPlacementQuestions(ctx, db, test.ID)
+	if err != nil {
+		return err
+	}
+	if len(questions) < placementQuestions {
+		return sendNextPlacementQuestion(ctx, bot, chatID, db, openaiClient, gptConfig, test, questions)
+	}
+	return finishPlacementTest(ctx, bot, chatID, db, test, questions)
+}
+
+// finishPlacementTest stores the level the answers place the user at and
+// switches the user back to the mode before the test
+func finishPlacementTest(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, db *sql.DB, test *storage.PlacementTest, questions []storage.PlacementQuestion) error {
+	level := placementLevel(questions)
+	if err := storage.FinishPlacementTest(ctx, db, test, level); err != nil {
+		slog.ErrorContext(ctx, "Error finishing placement test", "error", err)
+		return err
+	}
+	if err := storage.UpdateUserLanguageHelpType(ctx, db, test.UserID, test.Language, test.PreviousHelpType); err != nil {
+		slog.ErrorContext(ctx, "Error updating user help_type", "error", err)
+	}
+	resetChatDifficulty(ctx, db, test.UserID, test.Language, level)
+
+	right := 0
+	for _, question := range questions {
+		if question.Correct {
+			right++
+		}
+	}
+	text := fmt.Sprintf("Test finished: %d of %d correct. Your %s level is %s. Examples, translations and conversations are now adapted to it; "+
+		"send /level test to take the test again.", right, len(questions), test.Language, level)
+	_, err := send(ctx, bot, tgbotapi.NewMessage(chatID, text))
+	return err
+}
@@ -0,0 +1,242 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"language-learning-bot/pkg/answer"
+	storage "language-learning-bot/pkg/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// quizQuestions is the number of questions of a quiz
+	quizQuestions = 5
+	// quizOptions is the number of answer options of a question
+	quizOptions = 4
+
+	quizToMeaning = "to_meaning"
+	quizToWord    = "to_word"
+)
+
+// vocabularyItem is a looked up word with its English meaning
+type vocabularyItem struct {
+	Word    string
+	Meaning string
+}
+
+// lookedUpVocabulary returns the distinct words the user looked up with the
+// meaning from their structured answers
+func lookedUpVocabulary(ctx context.Context, db *sql.DB, userID int, language string) ([]vocabularyItem, error) {
+	lookups, err := storage.GetStructuredLookups(ctx, db, userID, language)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []vocabularyItem
+	seen := make(map[string]bool)
+	for _, lookup := range lookups {
+		structured, err := answer.Parse(lookup.Structured)
+		if err != nil {
+			slog.WarnContext(ctx, "Error parsing structured response", "error", err)
+			continue
+		}
+		word := strings.TrimSpace(structured.Headword)
+		meaning := strings.TrimSpace(structured.Translation)
+		if word == "" || meaning == "" || strings.EqualFold(word, meaning) || seen[strings.ToLower(word)] {
+			continue
+		}
+		seen[strings.ToLower(word)] = true
+		items = append(items, vocabularyItem{Word: word, Meaning: meaning})
+	}
+	return items, nil
+}
+
+// buildQuizQuestions picks words to ask for and, for each, the distractors
+// from the other words. The direction of each question is random.
+func buildQuizQuestions(items []vocabularyItem, language string, count int) []storage.QuizQuestion {
+	order := rand.Perm(len(items))
+	if len(order) > count {
+		order = order[:count]
+	}
+
+	questions := make([]storage.QuizQuestion, 0, len(order))
+	for _, index := range order {
+		item := items[index]
+		toMeaning := rand.Intn(2) == 0
+		answerOf := func(item vocabularyItem) string {
+			if toMeaning {
+				return item.Meaning
+			}
+			return item.Word
+		}
+
+		options := []string{answerOf(item)}
+		for _, other := range rand.Perm(len(items)) {
+			if len(options) == quizOptions {
+				break
+			}
+			option := answerOf(items[other])
+			if !containsFold(options, option) {
+				options = append(options, option)
+			}
+		}
+		rand.Shuffle(len(options), func(i, j int) { options[i], options[j] = options[j], options[i] })
+
+		question := storage.QuizQuestion{
+			Word:    item.Word,
+			Options: options,
+		}
+		for i, option := range options {
+			if option == answerOf(item) {
+				question.Correct = i
+			}
+		}
+		if toMeaning {
+			question.Direction = quizToMeaning
+			question.Prompt = fmt.Sprintf("What does «%s» mean?", item.Word)
+		} else {
+			question.Direction = quizToWord
+			question.Prompt = fmt.Sprintf("How do you say «%s» in %s?", item.Meaning, language)
+		}
+		questions = append(questions, question)
+	}
+	return questions
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func handleQuizCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB) error {
+	userID := int(message.From.ID)
+	language, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
+		return err
+	}
+
+	items, err := lookedUpVocabulary(ctx, db, userID, language)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting looked up words", "error", err)
+		return err
+	}
+	if len(items) < quizOptions {
+		text := fmt.Sprintf("You need to look up at least %d %s words before I can quiz you, you have %d so far.", quizOptions, language, len(items))
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+		return err
+	}
+
+	questions := buildQuizQuestions(items, language, quizQuestions)
+	if _, err := storage.CreateQuiz(ctx, db, userID, language, questions); err != nil {
+		slog.ErrorContext(ctx, "Error creating quiz", "error", err)
+		return err
+	}
+	return sendQuizQuestion(ctx, bot, message.Chat.ID, &questions[0])
+}
+
+func sendQuizQuestion(ctx context.Context, bot *tgbotapi.BotAPI, chatID int64, question *storage.QuizQuestion) error {
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Question %d/%d\n%s", question.Position+1, question.Total, question.Prompt))
+	msg.ReplyMarkup = quizInlineKeyboard(question)
+	_, err := send(ctx, bot, msg)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error sending quiz question", "error", err)
+		return err
+	}
+	return nil
+}
+
+// quizInlineKeyboard returns an inline keyboard with a row per answer option
+func quizInlineKeyboard(question *storage.QuizQuestion) tgbotapi.InlineKeyboardMarkup {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup()
+	for i, option := range question.Options {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(option, fmt.Sprintf("quiz:%d:%d", question.ID, i)),
+		))
+	}
+	return keyboard
+}
+
+// handleQuizCallback scores the picked option, shows the correct answer and
+// sends the next question or the score of the quiz
+func handleQuizCallback(ctx context.Context, bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, data string) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 {
+		slog.ErrorContext(ctx, "Invalid quiz callback data", "data", data)
+		return
+	}
+	questionID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		slog.ErrorContext(ctx, "Error parsing quiz question", "error", err)
+		return
+	}
+	chosen, err := strconv.Atoi(parts[2])
+	if err != nil {
+		slog.ErrorContext(ctx, "Error parsing quiz option", "error", err)
+		return
+	}
+
+	userID := int(callbackQuery.From.ID)
+	question, err := storage.GetQuizQuestion(ctx, db, userID, questionID)
+	if err != nil || question == nil || chosen < 0 || chosen >= len(question.Options) {
+		slog.ErrorContext(ctx, "Error getting quiz question", "error", err, "question", questionID)
+		return
+	}
+	answered, err := storage.AnswerQuizQuestion(ctx, db, questionID, chosen)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error answering quiz question", "error", err)
+		return
+	}
+	if !answered {
+		// the button was pressed twice
+		return
+	}
+
+	correctOption := question.Options[question.Correct]
+	result := "✅ Correct!"
+	if chosen != question.Correct {
+		result = fmt.Sprintf("❌ It is «%s».", correctOption)
+		mistake := storage.Mistake{Category: "vocabulary", Original: question.Options[chosen], Corrected: correctOption}
+		if err := storage.RecordMistakes(ctx, db, userID, question.Language, "quiz", []storage.Mistake{mistake}); err != nil {
+			slog.ErrorContext(ctx, "Error recording mistakes", "error", err)
+		}
+	}
+	msg := tgbotapi.NewEditMessageText(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID,
+		fmt.Sprintf("%s\nYou picked «%s». %s", callbackQuery.Message.Text, question.Options[chosen], result))
+	if _, err := send(ctx, bot, msg); err != nil {
+		slog.ErrorContext(ctx, "Error sending quiz result", "error", err)
+	}
+
+	next, err := storage.GetNextQuizQuestion(ctx, db, question.QuizID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting next quiz question", "error", err)
+		return
+	}
+	if next != nil {
+		if err := sendQuizQuestion(ctx, bot, callbackQuery.Message.Chat.ID, next); err != nil {
+			slog.ErrorContext(ctx, "Error sending quiz question", "error", err)
+		}
+		return
+	}
+
+	score, err := storage.FinishQuiz(ctx, db, question.QuizID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error finishing quiz", "error", err)
+		return
+	}
+	text := fmt.Sprintf("Quiz finished: %d of %d correct. Choose /quiz to play again.", score.Score, score.Total)
+	if _, err := send(ctx, bot, tgbotapi.NewMessage(callbackQuery.Message.Chat.ID, text)); err != nil {
+		slog.ErrorContext(ctx, "Error sending quiz score", "error", err)
+	}
+}
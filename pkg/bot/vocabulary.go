@@ -0,0 +1,277 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"language-learning-bot/pkg/answer"
+	storage "language-learning-bot/pkg/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// wordsPageSize is the number of saved words shown per page of /words
+	wordsPageSize = 10
+	// wordsMaxFilter is the longest search that fits the callback data of the
+	// page buttons, which Telegram limits to 64 bytes
+	wordsMaxFilter = 48
+	// wordsMaxMeaning is the length the meaning of a word is cut to in /words
+	wordsMaxMeaning = 60
+)
+
+// splitTags separates the #tags of command arguments from the other text.
+// Tags prefixed with a minus, as in -#travel, are returned as removed.
+func splitTags(arguments string) (text string, added, removed []string) {
+	var words []string
+	for _, field := range strings.Fields(arguments) {
+		switch {
+		case strings.HasPrefix(field, "-#") && len(field) > 2:
+			removed = append(removed, strings.ToLower(field[2:]))
+		case strings.HasPrefix(field, "#") && len(field) > 1:
+			added = append(added, strings.ToLower(field[1:]))
+		default:
+			words = append(words, field)
+		}
+	}
+	return strings.Join(words, " "), added, removed
+}
+
+func formatTags(tags []string) string {
+	formatted := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		formatted = append(formatted, "#"+tag)
+	}
+	return strings.Join(formatted, " ")
+}
+
+func handleSaveCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB) error {
+	userID := int(message.From.ID)
+	word, tags, _ := splitTags(message.CommandArguments())
+
+	var language string
+	if word == "" {
+		// without a word the last looked up one is saved
+		lastQuery, err := storage.GetLastUserQuery(ctx, db, userID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error getting last query", "error", err)
+			return err
+		}
+		word, language = lastQuery.Word, lastQuery.Language
+	} else {
+		var err error
+		language, err = storage.GetUserLanguage(ctx, db, userID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error getting user language", "error", err)
+			return err
+		}
+	}
+	if word == "" {
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, "Look up a word first or give the word to save, e.g. /save huis #home."))
+		return err
+	}
+
+	added, err := storage.SaveWord(ctx, db, userID, language, word, tags)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error saving word", "error", err)
+		return err
+	}
+	text := fmt.Sprintf("Saved «%s» to your words.", word)
+	if !added {
+		text = fmt.Sprintf("«%s» is already in your words.", word)
+	}
+	if len(tags) > 0 {
+		text += " Tagged " + formatTags(tags) + "."
+	}
+	_, err = send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+	return err
+}
+
+func handleForgetCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB) error {
+	userID := int(message.From.ID)
+	word := strings.TrimSpace(message.CommandArguments())
+	if word == "" {
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, "Give the word to remove from your words, e.g. /forget huis."))
+		return err
+	}
+	language, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
+		return err
+	}
+
+	found, err := storage.ForgetWord(ctx, db, userID, language, word)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error forgetting word", "error", err)
+		return err
+	}
+	text := fmt.Sprintf("Removed «%s» from your words.", word)
+	if !found {
+		text = fmt.Sprintf("«%s» is not in your words.", word)
+	}
+	_, err = send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+	return err
+}
+
+func handleTagCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB) error {
+	userID := int(message.From.ID)
+	word, added, removed := splitTags(message.CommandArguments())
+	if word == "" || len(added)+len(removed) == 0 {
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, "Give a saved word and the tags to add or remove, e.g. /tag huis #home -#travel."))
+		return err
+	}
+	language, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
+		return err
+	}
+
+	found, err := storage.TagWord(ctx, db, userID, language, word, added, removed)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error tagging word", "error", err)
+		return err
+	}
+	text := fmt.Sprintf("Updated the tags of «%s».", word)
+	if !found {
+		text = fmt.Sprintf("«%s» is not in your words, save it with /save first.", word)
+	}
+	_, err = send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+	return err
+}
+
+// parseWordsFilter reads a /words filter: a #tag or a search text
+func parseWordsFilter(text string) storage.VocabularyFilter {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "#") && !strings.Contains(text, " ") {
+		return storage.VocabularyFilter{Tag: strings.ToLower(text[1:])}
+	}
+	return storage.VocabularyFilter{Search: text}
+}
+
+func handleWordsCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB) error {
+	filter := strings.TrimSpace(message.CommandArguments())
+	if len(filter) > wordsMaxFilter {
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Please search for at most %d characters.", wordsMaxFilter)))
+		return err
+	}
+
+	text, keyboard, err := wordsPage(ctx, db, int(message.From.ID), filter, 0)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing words", "error", err)
+		return err
+	}
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+	_, err = send(ctx, bot, msg)
+	return err
+}
+
+// handleWordsCallback shows another page of /words in place of the current one
+func handleWordsCallback(ctx context.Context, bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, data string) {
+	parts := strings.SplitN(data, ":", 3)
+	if len(parts) != 3 {
+		slog.ErrorContext(ctx, "Invalid words callback data", "data", data)
+		return
+	}
+	page, err := strconv.Atoi(parts[1])
+	if err != nil {
+		slog.ErrorContext(ctx, "Error parsing words page", "error", err)
+		return
+	}
+
+	text, keyboard, err := wordsPage(ctx, db, int(callbackQuery.From.ID), parts[2], page)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing words", "error", err)
+		return
+	}
+	var msg tgbotapi.EditMessageTextConfig
+	if keyboard != nil {
+		msg = tgbotapi.NewEditMessageTextAndMarkup(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, text, *keyboard)
+	} else {
+		msg = tgbotapi.NewEditMessageText(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, text)
+	}
+	if _, err := send(ctx, bot, msg); err != nil {
+		slog.ErrorContext(ctx, "Error sending words page", "error", err)
+	}
+}
+
+// wordsPage renders a page of the saved words matching the filter, with
+// buttons to the previous and next pages if there are any
+func wordsPage(ctx context.Context, db *sql.DB, userID int, filter string, page int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	language, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	entries, total, err := storage.GetVocabulary(ctx, db, userID, language, parseWordsFilter(filter), wordsPageSize, page*wordsPageSize)
+	if err != nil {
+		return "", nil, err
+	}
+	if total == 0 {
+		if filter != "" {
+			return fmt.Sprintf("No saved %s words match %s.", language, filter), nil, nil
+		}
+		return fmt.Sprintf("You have no saved %s words yet. Use /save after looking up a word.", language), nil, nil
+	}
+
+	var b strings.Builder
+	pages := (total + wordsPageSize - 1) / wordsPageSize
+	fmt.Fprintf(&b, "Your %s words", language)
+	if filter != "" {
+		fmt.Fprintf(&b, " matching %s", filter)
+	}
+	fmt.Fprintf(&b, " (%d, page %d/%d):\n", total, page+1, pages)
+	for i, entry := range entries {
+		fmt.Fprintf(&b, "\n%d. %s", page*wordsPageSize+i+1, entry.Word)
+		if meaning := vocabularyMeaning(ctx, entry); meaning != "" {
+			fmt.Fprintf(&b, " — %s", meaning)
+		}
+		if len(entry.Tags) > 0 {
+			fmt.Fprintf(&b, " %s", formatTags(entry.Tags))
+		}
+	}
+	if page == 0 && filter == "" {
+		tags, err := storage.GetVocabularyTags(ctx, db, userID, language)
+		if err != nil {
+			slog.WarnContext(ctx, "Error getting vocabulary tags", "error", err)
+		} else if len(tags) > 0 {
+			fmt.Fprintf(&b, "\n\nTags: %s", formatTags(tags))
+		}
+	}
+
+	row := tgbotapi.NewInlineKeyboardRow()
+	if page > 0 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("◀️ Previous", fmt.Sprintf("words:%d:%s", page-1, filter)))
+	}
+	if page < pages-1 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("Next ▶️", fmt.Sprintf("words:%d:%s", page+1, filter)))
+	}
+	if len(row) == 0 {
+		return b.String(), nil, nil
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row)
+	return b.String(), &keyboard, nil
+}
+
+// vocabularyMeaning returns the shortened translation of a saved word from
+// its structured answer, or an empty string if there is none
+func vocabularyMeaning(ctx context.Context, entry storage.VocabularyEntry) string {
+	if entry.Structured == "" {
+		return ""
+	}
+	structured, err := answer.Parse(entry.Structured)
+	if err != nil {
+		slog.WarnContext(ctx, "Error parsing structured response", "error", err)
+		return ""
+	}
+	meaning := []rune(strings.TrimSpace(structured.Translation))
+	if len(meaning) > wordsMaxMeaning {
+		return string(meaning[:wordsMaxMeaning-1]) + "…"
+	}
+	return string(meaning)
+}
@@ -0,0 +1,216 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"log/slog"
+	"strings"
+
+	"language-learning-bot/pkg/answer"
+	"language-learning-bot/pkg/config"
+	openai_api "language-learning-bot/pkg/openai"
+	storage "language-learning-bot/pkg/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// weakCategoriesCount is how many of the most frequent categories are
+	// reported and practiced
+	weakCategoriesCount = 3
+	// mistakeExamplesCount is how many recent mistakes are shown per category
+	mistakeExamplesCount = 3
+)
+
+// categoryLabel turns a category such as word_order into "word order"
+func categoryLabel(category string) string {
+	return strings.ReplaceAll(category, "_", " ")
+}
+
+// weakCategories returns the most frequent mistake categories of the user,
+// ordered by recent mistakes first
+func weakCategories(ctx context.Context, db *sql.DB, userID int, language string) ([]storage.CategoryStats, error) {
+	stats, err := storage.GetMistakeCategoryStats(ctx, db, userID, language)
+	if err != nil {
+		return nil, err
+	}
+	if len(stats) > weakCategoriesCount {
+		stats = stats[:weakCategoriesCount]
+	}
+	return stats, nil
+}
+
+func handleWeaknessesCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB) error {
+	userID := int(message.From.ID)
+	language, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
+		return err
+	}
+
+	stats, err := storage.GetMistakeCategoryStats(ctx, db, userID, language)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting mistake stats", "error", err)
+		return err
+	}
+
+	var b strings.Builder
+	if len(stats) == 0 {
+		b.WriteString("No mistakes recorded yet. Use /correct or /chat and I will keep track of what to work on.")
+	} else {
+		fmt.Fprintf(&b, "Your most frequent mistakes in %s:\n", language)
+		for i, s := range stats {
+			fmt.Fprintf(&b, "\n%d. %s: %d in the last 30 days%s, %d in total\n", i+1, categoryLabel(s.Category), s.Recent, trend(s), s.Total)
+			if i >= weakCategoriesCount {
+				continue
+			}
+			mistakes, err := storage.GetRecentMistakes(ctx, db, userID, language, s.Category, mistakeExamplesCount)
+			if err != nil {
+				slog.ErrorContext(ctx, "Error getting recent mistakes", "error", err)
+				continue
+			}
+			for _, m := range mistakes {
+				fmt.Fprintf(&b, "   %s → %s\n", m.Original, m.Corrected)
+			}
+		}
+		b.WriteString("\nUse /practice to get exercises for your weakest areas.")
+	}
+
+	_, err = send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, b.String()))
+	if err != nil {
+		slog.ErrorContext(ctx, "Error sending weaknesses report", "error", err)
+		return err
+	}
+	return nil
+}
+
+// trend compares the recent mistakes with the 30 days before
+func trend(s storage.CategoryStats) string {
+	switch {
+	case s.Recent > s.Previous:
+		return fmt.Sprintf(" (up from %d)", s.Previous)
+	case s.Recent < s.Previous:
+		return fmt.Sprintf(" (down from %d)", s.Previous)
+	}
+	return ""
+}
+
+func handlePracticeCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config) error {
+	userID := int(message.From.ID)
+	language, err := storage.GetUserLanguage(ctx, db, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting user language", "error", err)
+		return err
+	}
+
+	weaknesses, err := describeWeaknesses(ctx, db, userID, language)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error describing weaknesses", "error", err)
+		return err
+	}
+	if weaknesses == "" {
+		_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, "No mistakes recorded yet. Use /correct or /chat first, then I can make exercises for what you get wrong."))
+		return err
+	}
+
+	thinkMsgResponse, shouldReturn := sendThinkingMessage(ctx, message, bot)
+	if shouldReturn {
+		return nil
+	}
+	defer deleteThinkingMessage(ctx, message, thinkMsgResponse, bot)
+
+	gptRequest, err := BuildPracticeRequest(gptConfig, language, weaknesses)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error building practice request", "error", err)
+		return err
+	}
+	gptresponse, err := openai_api.GetGPTResponse(ctx, openaiClient, gptRequest)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting GPT response", "error", err)
+		return err
+	}
+	set, err := answer.ParsePracticeSet(gptresponse)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error parsing exercises", "error", err)
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, renderPracticeSet(set))
+	msg.ParseMode = tgbotapi.ModeHTML
+	_, err = send(ctx, bot, msg)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error sending exercises", "error", err)
+		return err
+	}
+	return nil
+}
+
+// describeWeaknesses lists the weakest categories of the user with recent
+// mistakes as examples for the practice prompt, or returns an empty string
+// if the user has made no mistakes
+func describeWeaknesses(ctx context.Context, db *sql.DB, userID int, language string) (string, error) {
+	stats, err := weakCategories(ctx, db, userID, language)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, s := range stats {
+		mistakes, err := storage.GetRecentMistakes(ctx, db, userID, language, s.Category, mistakeExamplesCount)
+		if err != nil {
+			return "", err
+		}
+		examples := make([]string, 0, len(mistakes))
+		for _, m := range mistakes {
+			examples = append(examples, fmt.Sprintf("%q instead of %q", m.Original, m.Corrected))
+		}
+		fmt.Fprintf(&b, "- %s: %s\n", categoryLabel(s.Category), strings.Join(examples, "; "))
+	}
+	return b.String(), nil
+}
+
+// BuildPracticeRequest renders the practice prompt template for the
+// weaknesses into a request for exercises
+func BuildPracticeRequest(gptConfig *config.Config, language, weaknesses string) (openai_api.GPTRequest, error) {
+	data := GptTemplateData{
+		Language:   language,
+		Weaknesses: weaknesses,
+	}
+
+	var gptPrompt strings.Builder
+	err := gptConfig.GptTemplatePractice.PromptTemplate.Execute(&gptPrompt, data)
+	if err != nil {
+		return openai_api.GPTRequest{}, err
+	}
+
+	return openai_api.GPTRequest{
+		Model:        gptConfig.ChatModel,
+		Prompt:       gptPrompt.String(),
+		WordOrPhrase: "Write the exercises.",
+		Schema:       answer.PracticeSchema,
+		SchemaName:   answer.PracticeSchemaName,
+	}, nil
+}
+
+// renderPracticeSet formats the exercises as Telegram HTML with the answers
+// hidden behind spoilers
+func renderPracticeSet(set *answer.PracticeSet) string {
+	var b strings.Builder
+	b.WriteString("<b>Practice</b> (tap the hidden text to see the answer)\n")
+	for i, exercise := range set.Exercises {
+		fmt.Fprintf(&b, "\n%d. <i>%s</i> (%s)\n%s\n<tg-spoiler>%s",
+			i+1,
+			html.EscapeString(exercise.Instruction),
+			html.EscapeString(categoryLabel(exercise.Category)),
+			html.EscapeString(exercise.Question),
+			html.EscapeString(exercise.Answer))
+		if exercise.Explanation != "" {
+			fmt.Fprintf(&b, " — %s", html.EscapeString(exercise.Explanation))
+		}
+		b.WriteString("</tg-spoiler>\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,259 @@
+package bot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"language-learning-bot/pkg/answer"
+	"language-learning-bot/pkg/config"
+	"language-learning-bot/pkg/logging"
+	openai_api "language-learning-bot/pkg/openai"
+	storage "language-learning-bot/pkg/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashabaranov/go-openai"
+)
+
+// wordOfDayAttempts is how often the model is asked again when it picks a
+// word that was already the word of the day
+const wordOfDayAttempts = 3
+
+func handleWordOfDayCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, db *sql.DB, gptConfig *config.Config) error {
+	userID := int(message.From.ID)
+	argument := strings.TrimSpace(message.CommandArguments())
+
+	var text string
+	switch {
+	case argument == "off":
+		if err := storage.UnsubscribeWordOfDay(ctx, db, userID); err != nil {
+			slog.ErrorContext(ctx, "Error unsubscribing from word of the day", "error", err)
+			return err
+		}
+		text = "You will no longer get a word of the day."
+
+	case argument == "":
+		deliveryTime, err := storage.GetWordOfDaySubscription(ctx, db, userID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error getting word of the day subscription", "error", err)
+			return err
+		}
+		if deliveryTime != "" {
+			text = fmt.Sprintf("You get a word of the day at %s UTC. Send /word_of_day HH:MM to change the time or /word_of_day off to stop.", deliveryTime)
+			break
+		}
+		if err := storage.SubscribeWordOfDay(ctx, db, userID, gptConfig.WordOfDayTime); err != nil {
+			slog.ErrorContext(ctx, "Error subscribing to word of the day", "error", err)
+			return err
+		}
+		text = fmt.Sprintf("You will get a word of the day at %s UTC. Send /word_of_day HH:MM to pick another time.", gptConfig.WordOfDayTime)
+
+	default:
+		deliveryTime, err := time.Parse("15:04", argument)
+		if err != nil {
+			text = "Please give the time as HH:MM in UTC, e.g. /word_of_day 08:30."
+			break
+		}
+		if err := storage.SubscribeWordOfDay(ctx, db, userID, deliveryTime.Format("15:04")); err != nil {
+			slog.ErrorContext(ctx, "Error subscribing to word of the day", "error", err)
+			return err
+		}
+		text = fmt.Sprintf("You will get a word of the day at %s UTC.", deliveryTime.Format("15:04"))
+	}
+
+	_, err := send(ctx, bot, tgbotapi.NewMessage(message.Chat.ID, text))
+	return err
+}
+
+// SendDueWordsOfDay sends the word of the day of their language to the
+// subscribers whose delivery time has passed today
+func SendDueWordsOfDay(ctx context.Context, bot *tgbotapi.BotAPI, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config, now time.Time) error {
+	day, clock := now.UTC().Format("2006-01-02"), now.UTC().Format("15:04")
+	subscribers, err := storage.GetDueWordOfDaySubscribers(ctx, db, day, clock)
+	if err != nil {
+		return err
+	}
+
+	for _, subscriber := range subscribers {
+		ctx := logging.WithUserID(ctx, int64(subscriber.UserID))
+		word, err := pickWordOfDay(ctx, db, openaiClient, gptConfig, subscriber.Language, day)
+		if err != nil {
+			// the subscriber is retried on the next check
+			slog.ErrorContext(ctx, "Error picking word of the day", "error", err, "language", subscriber.Language)
+			continue
+		}
+		if err := deliverWordOfDay(ctx, bot, db, openaiClient, gptConfig, subscriber.UserID, word); err != nil {
+			// the subscriber is retried on the next check
+			slog.ErrorContext(ctx, "Error sending word of the day", "error", err)
+			continue
+		}
+		if err := storage.MarkWordOfDaySent(ctx, db, subscriber.UserID, day); err != nil {
+			slog.ErrorContext(ctx, "Error marking word of the day as sent", "error", err)
+		}
+	}
+	return nil
+}
+
+// pickWordOfDay returns the word of the day of the language, picking it from
+// the frequency list or the model the first time it is asked for on the day
+func pickWordOfDay(ctx context.Context, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config, language, day string) (*storage.WordOfDay, error) {
+	word, err := storage.GetWordOfDay(ctx, db, language, day)
+	if err != nil || word != nil {
+		return word, err
+	}
+
+	past, err := storage.GetPastWordsOfDay(ctx, db, language)
+	if err != nil {
+		return nil, err
+	}
+	picked, err := wordFromList(gptConfig.WordListsDir, language, past)
+	if err != nil {
+		slog.WarnContext(ctx, "Error reading word list", "error", err, "language", language)
+	}
+	if picked == "" {
+		picked, err = generateWordOfDay(ctx, openaiClient, gptConfig, language, past)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := storage.StoreWordOfDay(ctx, db, language, day, picked); err != nil {
+		return nil, err
+	}
+	return storage.GetWordOfDay(ctx, db, language, day)
+}
+
+// wordFromList returns the most frequent word of the language's list that
+// was not picked before, or an empty string if there is no list or every
+// word of it was picked
+func wordFromList(dir, language string, past []string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(filepath.Join(dir, language+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		word := strings.TrimSpace(line)
+		if word == "" || strings.HasPrefix(word, "#") || containsFold(past, word) {
+			continue
+		}
+		return word, nil
+	}
+	return "", nil
+}
+
+// generateWordOfDay asks the model for a word that was not picked before
+func generateWordOfDay(ctx context.Context, openaiClient *openai.Client, gptConfig *config.Config, language string, past []string) (string, error) {
+	gptRequest, err := BuildWordOfDayRequest(gptConfig, language, past)
+	if err != nil {
+		return "", err
+	}
+	for attempt := 1; attempt <= wordOfDayAttempts; attempt++ {
+		gptresponse, err := openai_api.GetGPTResponse(ctx, openaiClient, gptRequest)
+		if err != nil {
+			return "", err
+		}
+		word, err := answer.ParseWordOfDay(gptresponse)
+		if err != nil {
+			return "", err
+		}
+		if !containsFold(past, word.Word) {
+			return word.Word, nil
+		}
+		slog.WarnContext(ctx, "Word of the day was picked before", "attempt", attempt)
+	}
+	return "", errors.New("no new word of the day")
+}
+
+// BuildWordOfDayRequest renders the word of the day prompt template into a
+// request listing the words picked before
+func BuildWordOfDayRequest(gptConfig *config.Config, language string, past []string) (openai_api.GPTRequest, error) {
+	data := GptTemplateData{
+		Language: language,
+	}
+
+	var gptPrompt strings.Builder
+	err := gptConfig.GptTemplateWordOfDay.PromptTemplate.Execute(&gptPrompt, data)
+	if err != nil {
+		return openai_api.GPTRequest{}, err
+	}
+
+	message := "Pick the word of the day."
+	if len(past) > 0 {
+		message += " Already picked: " + strings.Join(past, ", ")
+	}
+	return openai_api.GPTRequest{
+		Model:        gptConfig.ChatModel,
+		Prompt:       gptPrompt.String(),
+		WordOrPhrase: message,
+		Schema:       answer.WordOfDaySchema,
+		SchemaName:   answer.WordOfDaySchemaName,
+	}, nil
+}
+
+// deliverWordOfDay sends the translation and examples of the word, looked up
+// like any other word, with a button to save it to the user's words, and its
+// pronunciation
+func deliverWordOfDay(ctx context.Context, bot *tgbotapi.BotAPI, db *sql.DB, openaiClient *openai.Client, gptConfig *config.Config, userID int, word *storage.WordOfDay) error {
+	translation, err := ProcessQuery(ctx, gptConfig, "translation", word.Language, word.Word, db, userID, openaiClient)
+	if err != nil {
+		return err
+	}
+	examples, err := ProcessQuery(ctx, gptConfig, "examples", word.Language, word.Word, db, userID, openaiClient)
+	if err != nil {
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(int64(userID), fmt.Sprintf("📅 Word of the day: %s\n\n%s\n\n%s", word.Word, translation, examples))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ Save to my words", fmt.Sprintf("word_of_day:%d", word.ID)),
+	))
+	if _, err := send(ctx, bot, msg); err != nil {
+		return err
+	}
+	// the word is delivered once the message is sent, so that a retry does
+	// not send it twice
+	if err := sendAudioMessage(ctx, openaiClient, db, word.Word, userID, bot, gptConfig.TTSConfig); err != nil {
+		slog.ErrorContext(ctx, "Error sending word of the day pronunciation", "error", err)
+	}
+	return nil
+}
+
+// handleWordOfDayCallback saves the word of the day to the user's words
+func handleWordOfDayCallback(ctx context.Context, bot *tgbotapi.BotAPI, callbackQuery *tgbotapi.CallbackQuery, db *sql.DB, data string) {
+	wordID, err := strconv.Atoi(strings.TrimPrefix(data, "word_of_day:"))
+	if err != nil {
+		slog.ErrorContext(ctx, "Error parsing word of the day", "error", err)
+		return
+	}
+	word, err := storage.GetWordOfDayByID(ctx, db, wordID)
+	if err != nil || word == nil {
+		slog.ErrorContext(ctx, "Error getting word of the day", "error", err, "word_of_day", wordID)
+		return
+	}
+
+	added, err := storage.SaveWord(ctx, db, int(callbackQuery.From.ID), word.Language, word.Word, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error saving word", "error", err)
+		return
+	}
+	text := fmt.Sprintf("Saved «%s» to your words.", word.Word)
+	if !added {
+		text = fmt.Sprintf("«%s» is already in your words.", word.Word)
+	}
+	if _, err := send(ctx, bot, tgbotapi.NewMessage(callbackQuery.Message.Chat.ID, text)); err != nil {
+		slog.ErrorContext(ctx, "Error sending save confirmation", "error", err)
+	}
+}
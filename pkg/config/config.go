@@ -1,8 +1,11 @@
 package config
 
 import (
-	"os"
-	"path/filepath"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
 	"strings"
 	template "text/template"
 
@@ -15,6 +18,7 @@ type GptPromptTuning struct {
 	Language string
 	HelpType string
 	Messages []openai.ChatCompletionMessage
+	Metadata TuningMetadata
 }
 
 type GptRequestType struct {
@@ -24,6 +28,7 @@ type GptRequestType struct {
 }
 
 type TTSConfig struct {
+	Model string
 	Voice string
 	Speed float64
 }
@@ -32,15 +37,30 @@ type Config struct {
 	GptTemplateWordUsageExamples *GptRequestType
 	GptTemplateWordTranslation   *GptRequestType
 	GptTemplateInflection        *GptRequestType
+	GptTemplateChat              *GptRequestType
+	GptTemplateCorrection        *GptRequestType
+	GptTemplatePractice          *GptRequestType
+	GptTemplateDictation         *GptRequestType
+	GptTemplateWordOfDay         *GptRequestType
+	GptTemplatePlacement         *GptRequestType
+	GptTemplateDetectLanguage    *GptRequestType
 	GptPromptTunings             GptPromptTuningByLanguageAndHelpType
+	ChatModel                    string
 	TTSConfig                    *TTSConfig
+	SpeechSpeeds                 []SpeechSpeed
+	ChatScenarios                []ChatScenario
+	ChatHistoryWindow            int
+	WordOfDayTime                string
+	WordListsDir                 string
 }
 
-func NewGptPromptTuningFromTextFiles() (GptPromptTuningByLanguageAndHelpType, error) {
+// NewGptPromptTuningFromTextFiles reads the tunings in the <help type>/<language>.txt
+// and <help type>/<language>.yaml files of the templates filesystem
+func NewGptPromptTuningFromTextFiles(fsys fs.FS) (GptPromptTuningByLanguageAndHelpType, error) {
 	promptTunings := make(GptPromptTuningByLanguageAndHelpType)
 
 	// Read all files in templates/examples and templates/translation directories
-	helpTypeDirectory, err := os.ReadDir("templates/")
+	helpTypeDirectory, err := fs.ReadDir(fsys, ".")
 	if err != nil {
 		return nil, err
 	}
@@ -48,32 +68,34 @@ func NewGptPromptTuningFromTextFiles() (GptPromptTuningByLanguageAndHelpType, er
 	for _, file := range helpTypeDirectory {
 		if file.IsDir() {
 			helpType := file.Name()
-			helpTypeDirectory, err := os.ReadDir(filepath.Join("templates", helpType))
+			helpTypeDirectory, err := fs.ReadDir(fsys, helpType)
 			if err != nil {
 				return nil, err
 			}
 			for _, file := range helpTypeDirectory {
-				if !file.IsDir() && strings.HasSuffix(file.Name(), ".txt") {
-					language := strings.TrimSuffix(file.Name(), ".txt")
-					filePath := filepath.Join("templates", helpType, file.Name())
+				language, ok := tuningLanguage(file.Name())
+				if !file.IsDir() && ok {
+					filePath := path.Join(helpType, file.Name())
 
-					content, err := os.ReadFile(filePath)
+					content, err := fs.ReadFile(fsys, filePath)
+					if err != nil {
+						return nil, err
+					}
+					chatCompletionMessages, metadata, err := parseTuningFile(filePath, content)
 					if err != nil {
 						return nil, err
 					}
-					var chatCompletionMessages []openai.ChatCompletionMessage
-					chatCompletionMessages = getChatCompletionMessages(content)
 					promptTuning := GptPromptTuning{
 						Language: language,
 						HelpType: helpType,
 						Messages: chatCompletionMessages,
+						Metadata: metadata,
 					}
 
 					if _, ok := promptTunings[language]; !ok {
 						promptTunings[language] = make(map[string]GptPromptTuning)
 					}
 					promptTunings[language][helpType] = promptTuning
-					chatCompletionMessages = nil
 				}
 			}
 		}
@@ -99,33 +121,172 @@ func getChatCompletionMessages(content []byte) []openai.ChatCompletionMessage {
 	return chatCompletionMessages
 }
 
-// NewConfig creates a new config
-func NewConfig() *Config {
-	gptPromptTunings, err := NewGptPromptTuningFromTextFiles()
+// LoadConfig reads the prompt templates and tunings, combines them with the
+// model and speech settings and validates them
+func LoadConfig(settings *Settings) (*Config, error) {
+	fsys := TemplatesFS(settings.Templates.OverrideDir)
+	issues := Lint(fsys)
+	for _, issue := range issues {
+		if issue.Severity == SeverityWarning {
+			slog.Warn("Prompt lint warning", "issue", issue.String())
+		}
+	}
+	if err := LintErrors(issues); err != nil {
+		return nil, fmt.Errorf("invalid prompt files:\n%w", err)
+	}
+	gptPromptTunings, err := NewGptPromptTuningFromTextFiles(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	examplesTemplate, err := template.ParseFS(fsys, "examples.txt")
+	if err != nil {
+		return nil, err
+	}
+	translationTemplate, err := template.ParseFS(fsys, "translation.txt")
+	if err != nil {
+		return nil, err
+	}
+	inflectionTemplate, err := template.ParseFS(fsys, "inflection.txt")
+	if err != nil {
+		return nil, err
+	}
+	chatTemplate, err := template.ParseFS(fsys, "chat.txt")
+	if err != nil {
+		return nil, err
+	}
+	correctionTemplate, err := template.ParseFS(fsys, "correct.txt")
+	if err != nil {
+		return nil, err
+	}
+	practiceTemplate, err := template.ParseFS(fsys, "practice.txt")
+	if err != nil {
+		return nil, err
+	}
+	dictationTemplate, err := template.ParseFS(fsys, "dictation.txt")
+	if err != nil {
+		return nil, err
+	}
+	wordOfDayTemplate, err := template.ParseFS(fsys, "word_of_day.txt")
+	if err != nil {
+		return nil, err
+	}
+	placementTemplate, err := template.ParseFS(fsys, "placement.txt")
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	detectLanguageTemplate, err := template.ParseFS(fsys, "detect_language.txt")
+	if err != nil {
+		return nil, err
 	}
 
 	config := &Config{
 		GptPromptTunings: gptPromptTunings,
 		GptTemplateWordUsageExamples: &GptRequestType{
 			HelpType:       "examples",
-			PromptTemplate: template.Must(template.ParseFiles("templates/examples.txt")),
+			PromptTemplate: examplesTemplate,
 		},
 
 		GptTemplateWordTranslation: &GptRequestType{
 			HelpType:       "translation",
-			PromptTemplate: template.Must(template.ParseFiles("templates/translation.txt")),
+			PromptTemplate: translationTemplate,
 		},
 
 		GptTemplateInflection: &GptRequestType{
 			HelpType:       "inflection",
-			PromptTemplate: template.Must(template.ParseFiles("templates/inflection.txt")),
+			PromptTemplate: inflectionTemplate,
+		},
+
+		GptTemplateChat: &GptRequestType{
+			HelpType:       "chat",
+			PromptTemplate: chatTemplate,
+		},
+
+		GptTemplateCorrection: &GptRequestType{
+			HelpType:       "correct",
+			PromptTemplate: correctionTemplate,
+		},
+
+		GptTemplatePractice: &GptRequestType{
+			HelpType:       "practice",
+			PromptTemplate: practiceTemplate,
+		},
+
+		GptTemplateDictation: &GptRequestType{
+			HelpType:       "dictation",
+			PromptTemplate: dictationTemplate,
+		},
+
+		GptTemplateWordOfDay: &GptRequestType{
+			HelpType:       "word_of_day",
+			PromptTemplate: wordOfDayTemplate,
+		},
+
+		GptTemplatePlacement: &GptRequestType{
+			HelpType:       "placement",
+			PromptTemplate: placementTemplate,
 		},
+
+		GptTemplateDetectLanguage: &GptRequestType{
+			HelpType:       "detect_language",
+			PromptTemplate: detectLanguageTemplate,
+		},
+		ChatModel: settings.OpenAI.ChatModel,
 		TTSConfig: &TTSConfig{
-			Voice: "nova",
-			Speed: 1,
+			Model: settings.OpenAI.TTSModel,
+			Voice: settings.OpenAI.TTSVoice,
+			Speed: settings.Speech.DefaultSpeed,
 		},
+		SpeechSpeeds:      settings.Speech.Speeds,
+		ChatScenarios:     settings.Chat.Scenarios,
+		ChatHistoryWindow: settings.Chat.HistoryWindow,
+		WordOfDayTime:     settings.WordOfDay.DefaultTime,
+		WordListsDir:      settings.WordOfDay.WordListsDir,
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// TemplateVariables are the fields available to the prompt templates
+var TemplateVariables = []string{"Language", "MessageText", "Scenario", "Difficulty", "Weaknesses", "Level"}
+
+// RequestTypes returns the prompt templates of all help types and modes
+func (c *Config) RequestTypes() []*GptRequestType {
+	return []*GptRequestType{
+		c.GptTemplateWordUsageExamples,
+		c.GptTemplateWordTranslation,
+		c.GptTemplateInflection,
+		c.GptTemplateChat,
+		c.GptTemplateCorrection,
+		c.GptTemplatePractice,
+		c.GptTemplateDictation,
+		c.GptTemplateWordOfDay,
+		c.GptTemplatePlacement,
+		c.GptTemplateDetectLanguage,
+	}
+}
+
+// Validate checks that every prompt template renders with the known template
+// variables and that every tuning has at least one message
+func (c *Config) Validate() error {
+	sample := make(map[string]string, len(TemplateVariables))
+	for _, name := range TemplateVariables {
+		sample[name] = name
+	}
+	for _, requestType := range c.RequestTypes() {
+		err := requestType.PromptTemplate.Option("missingkey=error").Execute(io.Discard, sample)
+		if err != nil {
+			return fmt.Errorf("template for %s: %w", requestType.HelpType, err)
+		}
+	}
+	for language, tunings := range c.GptPromptTunings {
+		for helpType, tuning := range tunings {
+			if len(tuning.Messages) == 0 {
+				return fmt.Errorf("prompt tuning %s/%s has no messages", helpType, language)
+			}
+		}
 	}
-	return config
+	return nil
 }
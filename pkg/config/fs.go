@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+
+	languagelearningbot "language-learning-bot"
+)
+
+// TemplatesFS returns the filesystem prompt templates are read from: the
+// templates embedded in the binary, with files in overrideDir, if set,
+// taking precedence over the embedded ones
+func TemplatesFS(overrideDir string) fs.FS {
+	if overrideDir == "" {
+		return languagelearningbot.Templates()
+	}
+	return overlayFS{upper: os.DirFS(overrideDir), lower: languagelearningbot.Templates()}
+}
+
+// overlayFS serves files from upper, falling back to lower for files that do
+// not exist in upper. Directory listings are merged, except that a tuning
+// file of upper replaces the tuning files of lower for the same help type
+// and language, whichever format either is in.
+type overlayFS struct {
+	upper fs.FS
+	lower fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	file, err := o.upper.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.lower.Open(name)
+	}
+	return file, err
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	upperEntries, upperErr := fs.ReadDir(o.upper, name)
+	if upperErr != nil && !errors.Is(upperErr, fs.ErrNotExist) {
+		return nil, upperErr
+	}
+	lowerEntries, lowerErr := fs.ReadDir(o.lower, name)
+	if lowerErr != nil && !errors.Is(lowerErr, fs.ErrNotExist) {
+		return nil, lowerErr
+	}
+	if upperErr != nil && lowerErr != nil {
+		return nil, upperErr
+	}
+
+	overridden := make(map[string]bool)
+	for _, entry := range upperEntries {
+		if language, ok := tuningLanguage(entry.Name()); ok && name != "." && !entry.IsDir() {
+			overridden[language] = true
+		}
+	}
+	entries := make(map[string]fs.DirEntry, len(upperEntries)+len(lowerEntries))
+	for _, entry := range lowerEntries {
+		if language, ok := tuningLanguage(entry.Name()); ok && name != "." && overridden[language] {
+			continue
+		}
+		entries[entry.Name()] = entry
+	}
+	for _, entry := range upperEntries {
+		entries[entry.Name()] = entry
+	}
+
+	merged := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		merged = append(merged, entry)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+	return merged, nil
+}
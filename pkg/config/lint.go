@@ -0,0 +1,380 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/sashabaranov/go-openai"
+	"gopkg.in/yaml.v3"
+)
+
+// HelpTypes are the help types that have a prompt template
+var HelpTypes = []string{"examples", "translation", "inflection"}
+
+// ModeTemplates are the templates of modes that are not answered with a
+// word answer, such as conversations and corrections, so they have no tunings
+var ModeTemplates = []string{"chat", "correct", "practice", "dictation", "word_of_day", "placement", "detect_language"}
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// LintIssue is a problem found in a template or tuning file
+type LintIssue struct {
+	File     string
+	Line     int
+	Severity Severity
+	Message  string
+}
+
+func (i LintIssue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", i.File, i.Line, i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.File, i.Severity, i.Message)
+}
+
+// LintErrors returns an error listing the issues with error severity, or nil
+// if there are none
+func LintErrors(issues []LintIssue) error {
+	var errs []error
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			errs = append(errs, errors.New(issue.String()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Lint checks the prompt templates and tuning files in fsys:
+//   - every help type and mode has a template that parses and only uses TemplateVariables
+//   - prompt templates do not contain stray role lines such as "User"
+//   - tuning lines are "role: content" with a user or assistant role, or
+//     valid YAML with known keys and sane metadata
+//   - there is at most one tuning file per help type and language
+//   - tuning messages alternate user/assistant, starting with user and ending
+//     with assistant
+//   - every language has a tuning for every help type
+func Lint(fsys fs.FS) []LintIssue {
+	var issues []LintIssue
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return []LintIssue{{File: ".", Severity: SeverityError, Message: err.Error()}}
+	}
+
+	languagesByHelpType := make(map[string]map[string]bool)
+	allLanguages := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() {
+			if strings.HasSuffix(name, ".txt") {
+				issues = append(issues, lintTemplate(fsys, name)...)
+			}
+			continue
+		}
+		if !isHelpType(name) {
+			issues = append(issues, LintIssue{File: name, Severity: SeverityWarning, Message: "directory is not a known help type"})
+		}
+		files, err := fs.ReadDir(fsys, name)
+		if err != nil {
+			issues = append(issues, LintIssue{File: name, Severity: SeverityError, Message: err.Error()})
+			continue
+		}
+		languagesByHelpType[name] = make(map[string]bool)
+		for _, file := range files {
+			language, ok := tuningLanguage(file.Name())
+			if file.IsDir() || !ok {
+				continue
+			}
+			if languagesByHelpType[name][language] {
+				issues = append(issues, LintIssue{File: path.Join(name, file.Name()), Severity: SeverityError, Message: fmt.Sprintf("more than one %s tuning file for %s", name, language)})
+			}
+			languagesByHelpType[name][language] = true
+			allLanguages[language] = true
+			issues = append(issues, lintTuning(fsys, path.Join(name, file.Name()))...)
+		}
+	}
+
+	for _, mode := range ModeTemplates {
+		if _, err := fs.Stat(fsys, mode+".txt"); err != nil {
+			issues = append(issues, LintIssue{File: mode + ".txt", Severity: SeverityError, Message: "missing prompt template for mode " + mode})
+		}
+	}
+	for _, helpType := range HelpTypes {
+		if _, err := fs.Stat(fsys, helpType+".txt"); err != nil {
+			issues = append(issues, LintIssue{File: helpType + ".txt", Severity: SeverityError, Message: "missing prompt template for help type " + helpType})
+		}
+		for _, language := range sortedKeys(allLanguages) {
+			if !languagesByHelpType[helpType][language] {
+				issues = append(issues, LintIssue{
+					File:     path.Join(helpType, language+".txt"),
+					Severity: SeverityWarning,
+					Message:  fmt.Sprintf("no %s tuning for %s, requests will have no examples", helpType, language),
+				})
+			}
+		}
+	}
+	return issues
+}
+
+func lintTemplate(fsys fs.FS, name string) []LintIssue {
+	var issues []LintIssue
+	helpType := strings.TrimSuffix(name, ".txt")
+	if !isHelpType(helpType) && !isModeTemplate(helpType) {
+		issues = append(issues, LintIssue{File: name, Severity: SeverityWarning, Message: "template is not used by any help type"})
+	}
+
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return append(issues, LintIssue{File: name, Severity: SeverityError, Message: err.Error()})
+	}
+	for i, line := range strings.Split(string(content), "\n") {
+		if isRole(strings.ToLower(strings.TrimSpace(line))) {
+			issues = append(issues, LintIssue{File: name, Line: i + 1, Severity: SeverityWarning, Message: fmt.Sprintf("stray role line %q in prompt template", strings.TrimSpace(line))})
+		}
+	}
+
+	tmpl, err := template.New(name).Parse(string(content))
+	if err != nil {
+		return append(issues, LintIssue{File: name, Line: errorLine(err.Error()), Severity: SeverityError, Message: err.Error()})
+	}
+	walkFields(tmpl.Tree.Root, func(node *parse.FieldNode) {
+		if !isTemplateVariable(node.Ident[0]) {
+			location, _ := tmpl.Tree.ErrorContext(node)
+			issues = append(issues, LintIssue{
+				File:     name,
+				Line:     errorLine(location),
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("unknown template variable .%s, expected one of %s", strings.Join(node.Ident, "."), strings.Join(TemplateVariables, ", ")),
+			})
+		}
+	})
+	return issues
+}
+
+// tuningLine is a single message of a tuning file with its position
+type tuningLine struct {
+	line    int
+	role    string
+	content string
+}
+
+func lintTuning(fsys fs.FS, name string) []LintIssue {
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return []LintIssue{{File: name, Severity: SeverityError, Message: err.Error()}}
+	}
+
+	var lines []tuningLine
+	var issues []LintIssue
+	if strings.HasSuffix(name, ".txt") {
+		lines, issues = textTuningLines(name, content)
+	} else {
+		lines, issues = yamlTuningLines(name, content)
+	}
+
+	expected := openai.ChatMessageRoleUser
+	lastLine := 0
+	for _, line := range lines {
+		if !isRole(line.role) {
+			issues = append(issues, LintIssue{File: name, Line: line.line, Severity: SeverityError, Message: fmt.Sprintf("invalid role %q, expected %q or %q", line.role, openai.ChatMessageRoleUser, openai.ChatMessageRoleAssistant)})
+			continue
+		}
+		if strings.TrimSpace(line.content) == "" {
+			issues = append(issues, LintIssue{File: name, Line: line.line, Severity: SeverityError, Message: "empty message"})
+		}
+		if line.role != expected {
+			issues = append(issues, LintIssue{File: name, Line: line.line, Severity: SeverityError, Message: fmt.Sprintf("expected a %s message, got %s", expected, line.role)})
+		}
+		lastLine = line.line
+		expected = nextRole(line.role)
+	}
+	if lastLine == 0 {
+		issues = append(issues, LintIssue{File: name, Severity: SeverityError, Message: "tuning has no messages"})
+	} else if expected != openai.ChatMessageRoleUser {
+		issues = append(issues, LintIssue{File: name, Line: lastLine, Severity: SeverityError, Message: "last user message has no assistant answer"})
+	}
+	return issues
+}
+
+// textTuningLines reads the messages of a "role: content" tuning file
+func textTuningLines(name string, content []byte) ([]tuningLine, []LintIssue) {
+	var lines []tuningLine
+	var issues []LintIssue
+	for i, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		role, message, found := strings.Cut(line, ":")
+		if !found {
+			issues = append(issues, LintIssue{File: name, Line: i + 1, Severity: SeverityError, Message: `line is not in "role: content" format`})
+			continue
+		}
+		lines = append(lines, tuningLine{line: i + 1, role: strings.TrimSpace(role), content: message})
+	}
+	return lines, issues
+}
+
+// yamlTuningLines reads the messages of a YAML tuning file and checks its metadata
+func yamlTuningLines(name string, content []byte) ([]tuningLine, []LintIssue) {
+	var tuning yamlTuning
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&tuning); err != nil {
+		return nil, []LintIssue{{File: name, Line: yamlErrorLine(err), Severity: SeverityError, Message: err.Error()}}
+	}
+
+	var issues []LintIssue
+	if tuning.Temperature != nil && (*tuning.Temperature < 0 || *tuning.Temperature > 2) {
+		issues = append(issues, LintIssue{File: name, Severity: SeverityError, Message: fmt.Sprintf("temperature must be between 0 and 2, got %g", *tuning.Temperature)})
+	}
+	if tuning.MaxTokens < 0 {
+		issues = append(issues, LintIssue{File: name, Severity: SeverityError, Message: fmt.Sprintf("max_tokens must not be negative, got %d", tuning.MaxTokens)})
+	}
+
+	// decode again into nodes to know the line of every message
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil || len(document.Content) == 0 {
+		return nil, issues
+	}
+	var lines []tuningLine
+	root := document.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "messages" {
+			continue
+		}
+		for j, message := range root.Content[i+1].Content {
+			lines = append(lines, tuningLine{
+				line:    message.Line,
+				role:    strings.TrimSpace(tuning.Messages[j].Role),
+				content: tuning.Messages[j].Content,
+			})
+		}
+	}
+	return lines, issues
+}
+
+func nextRole(role string) string {
+	if role == openai.ChatMessageRoleUser {
+		return openai.ChatMessageRoleAssistant
+	}
+	return openai.ChatMessageRoleUser
+}
+
+func isRole(role string) bool {
+	return role == openai.ChatMessageRoleUser || role == openai.ChatMessageRoleAssistant
+}
+
+func isHelpType(name string) bool {
+	for _, helpType := range HelpTypes {
+		if helpType == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isModeTemplate(name string) bool {
+	for _, mode := range ModeTemplates {
+		if mode == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isTemplateVariable(name string) bool {
+	for _, variable := range TemplateVariables {
+		if variable == name {
+			return true
+		}
+	}
+	return false
+}
+
+// errorLine extracts the line number from a "name:line:col" location
+func errorLine(location string) int {
+	parts := strings.Split(location, ":")
+	for _, part := range parts[1:] {
+		if line, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			return line
+		}
+	}
+	return 0
+}
+
+var yamlLineRegex = regexp.MustCompile(`line (\d+)`)
+
+// yamlErrorLine extracts the first line number from a YAML decoding error
+func yamlErrorLine(err error) int {
+	match := yamlLineRegex.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(match[1])
+	return line
+}
+
+// walkFields calls fn for every field reference (e.g. .Language) in the tree
+func walkFields(node parse.Node, fn func(*parse.FieldNode)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkFields(child, fn)
+		}
+	case *parse.ActionNode:
+		walkFields(n.Pipe, fn)
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.TemplateNode:
+		walkFields(n.Pipe, fn)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkFields(cmd, fn)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkFields(arg, fn)
+		}
+	case *parse.FieldNode:
+		fn(n)
+	}
+}
+
+func walkBranch(branch *parse.BranchNode, fn func(*parse.FieldNode)) {
+	walkFields(branch.Pipe, fn)
+	walkFields(branch.List, fn)
+	walkFields(branch.ElseList, fn)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
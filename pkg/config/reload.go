@@ -0,0 +1,124 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce groups bursts of file events (editors often write a file in
+// several steps) into a single reload
+const reloadDebounce = 500 * time.Millisecond
+
+// Store holds the active Config and swaps it atomically on reload
+type Store struct {
+	settings *Settings
+	current  atomic.Pointer[Config]
+}
+
+// NewStore loads the config from disk and returns a Store holding it
+func NewStore(settings *Settings) (*Store, error) {
+	config, err := LoadConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+	store := &Store{settings: settings}
+	store.current.Store(config)
+	return store, nil
+}
+
+// Get returns the active config. Callers should fetch it once per update and
+// keep using that snapshot, so a reload never mixes old and new prompts.
+func (s *Store) Get() *Config {
+	return s.current.Load()
+}
+
+// Reload loads and validates the config from disk and, if that succeeds,
+// makes it the active one. On error the previous config stays active.
+func (s *Store) Reload() error {
+	config, err := LoadConfig(s.settings)
+	if err != nil {
+		return err
+	}
+	s.current.Store(config)
+	return nil
+}
+
+// Watch reloads the config on SIGHUP and whenever a file under the templates
+// override directory changes, until ctx is cancelled
+func (s *Store) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	overrideDir := s.settings.Templates.OverrideDir
+	if overrideDir == "" {
+		// the embedded templates never change, only SIGHUP is handled
+		return s.watch(ctx, watcher)
+	}
+	err = filepath.WalkDir(overrideDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+	return s.watch(ctx, watcher)
+}
+
+func (s *Store) watch(ctx context.Context, watcher *fsnotify.Watcher) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer watcher.Close()
+		defer signal.Stop(signals)
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				s.reloadAndLog("SIGHUP")
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				slog.Debug("Template file changed", "file", event.Name, "op", event.Op.String())
+				debounce = time.After(reloadDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("Error watching templates", "error", err)
+			case <-debounce:
+				debounce = nil
+				s.reloadAndLog("file change")
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *Store) reloadAndLog(trigger string) {
+	err := s.Reload()
+	if err != nil {
+		slog.Error("Error reloading config, keeping the previous one", "trigger", trigger, "error", err)
+		return
+	}
+	slog.Info("Reloaded config", "trigger", trigger)
+}
@@ -0,0 +1,412 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// Settings is the runtime configuration of the bot. It is built from
+// defaults, an optional YAML file, environment variables and command line
+// flags, each overriding the previous one.
+type Settings struct {
+	Telegram  TelegramSettings  `yaml:"telegram"`
+	OpenAI    OpenAISettings    `yaml:"openai"`
+	Database  DatabaseSettings  `yaml:"database"`
+	HTTP      HTTPSettings      `yaml:"http"`
+	Cache     CacheSettings     `yaml:"cache"`
+	Speech    SpeechSettings    `yaml:"speech"`
+	Chat      ChatSettings      `yaml:"chat"`
+	WordOfDay WordOfDaySettings `yaml:"word_of_day"`
+	Log       LogSettings       `yaml:"log"`
+	Tracing   TracingSettings   `yaml:"tracing"`
+	Templates TemplatesSettings `yaml:"templates"`
+}
+
+type TelegramSettings struct {
+	Token          string  `yaml:"token"`
+	AllowedUserIDs []int64 `yaml:"allowed_user_ids"`
+}
+
+type OpenAISettings struct {
+	APIToken  string `yaml:"api_token"`
+	ChatModel string `yaml:"chat_model"`
+	TTSModel  string `yaml:"tts_model"`
+	TTSVoice  string `yaml:"tts_voice"`
+}
+
+type DatabaseSettings struct {
+	SQLitePath string `yaml:"sqlite_path"`
+}
+
+type HTTPSettings struct {
+	Addr string `yaml:"addr"`
+	Port int    `yaml:"port"`
+}
+
+type CacheSettings struct {
+	// CleanInterval is how often expired cached responses and speech are removed
+	CleanInterval time.Duration `yaml:"clean_interval"`
+	// TTL is how long a cached response or the speech of a word that is not
+	// saved is kept
+	TTL time.Duration `yaml:"ttl"`
+}
+
+type SpeechSpeed struct {
+	Label string  `yaml:"label"`
+	Value float64 `yaml:"value"`
+}
+
+type SpeechSettings struct {
+	// Speeds are the options offered by /speech_speed, in display order
+	Speeds []SpeechSpeed `yaml:"speeds"`
+	// DefaultSpeed is used when the user has not picked a speed
+	DefaultSpeed float64 `yaml:"default_speed"`
+}
+
+// ChatScenario is a role-play situation of the conversation practice mode
+type ChatScenario struct {
+	ID    string `yaml:"id"`
+	Label string `yaml:"label"`
+	// Description tells the model the setting and the roles
+	Description string `yaml:"description"`
+}
+
+type ChatSettings struct {
+	// Scenarios are the options offered by /chat, in display order
+	Scenarios []ChatScenario `yaml:"scenarios"`
+	// HistoryWindow is how many previous messages are sent with a chat message
+	HistoryWindow int `yaml:"history_window"`
+}
+
+type WordOfDaySettings struct {
+	// CheckInterval is how often subscriptions are checked for delivery
+	CheckInterval time.Duration `yaml:"check_interval"`
+	// DefaultTime is the UTC delivery time, HH:MM, when the user gives none
+	DefaultTime string `yaml:"default_time"`
+	// WordListsDir holds <language>.txt frequency lists with a word per line,
+	// most frequent first. Words are generated for languages without a list.
+	WordListsDir string `yaml:"word_lists_dir"`
+}
+
+type LogSettings struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+type TracingSettings struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type TemplatesSettings struct {
+	// OverrideDir holds prompt files that replace the embedded ones; it is
+	// watched for changes when set
+	OverrideDir string `yaml:"override_dir"`
+}
+
+// DefaultSettings returns the settings used when nothing is overridden
+func DefaultSettings() *Settings {
+	return &Settings{
+		OpenAI: OpenAISettings{
+			ChatModel: openai.GPT4o,
+			TTSModel:  string(openai.TTSModel1),
+			TTSVoice:  string(openai.VoiceNova),
+		},
+		Database: DatabaseSettings{SQLitePath: "./languagebot.db"},
+		HTTP:     HTTPSettings{Addr: "localhost", Port: 12833},
+		Cache: CacheSettings{
+			CleanInterval: 24 * time.Hour,
+			TTL:           24 * time.Hour,
+		},
+		Speech: SpeechSettings{
+			Speeds: []SpeechSpeed{
+				{Label: "Slow", Value: 0.5},
+				{Label: "Normal", Value: 0.7},
+				{Label: "Fast", Value: 1.0},
+			},
+			DefaultSpeed: 1.0,
+		},
+		Chat: ChatSettings{
+			Scenarios: []ChatScenario{
+				{ID: "cafe", Label: "Café", Description: "You are a waiter in a café and I am a customer ordering food and drinks."},
+				{ID: "doctor", Label: "Doctor", Description: "You are a doctor and I am a patient describing my symptoms at an appointment."},
+				{ID: "job_interview", Label: "Job interview", Description: "You are a recruiter interviewing me for a job I applied for."},
+			},
+			HistoryWindow: 10,
+		},
+		WordOfDay: WordOfDaySettings{
+			CheckInterval: time.Minute,
+			DefaultTime:   "09:00",
+		},
+		Log: LogSettings{Level: "info", Format: "text"},
+	}
+}
+
+// RegisterFlags adds the command line flags that override settings
+func RegisterFlags(flags *pflag.FlagSet) {
+	flags.String("config", "", "path to a YAML config file (env LANGEKKO_CONFIG)")
+	flags.String("sqlite-path", "", "path to the SQLite database")
+	flags.String("addr", "", "address of the HTTP server")
+	flags.Int("port", 0, "port of the HTTP server")
+	flags.String("chat-model", "", "OpenAI chat completion model")
+	flags.String("tts-voice", "", "OpenAI text-to-speech voice")
+	flags.String("log-level", "", "log level: debug, info, warn or error")
+	flags.String("log-format", "", "log format: text or json")
+	flags.Bool("tracing", false, "export OpenTelemetry traces over OTLP")
+	flags.String("templates-dir", "", "directory with prompt templates overriding the embedded ones")
+}
+
+// LoadSettings builds the settings from defaults, the config file, the
+// environment and the flags registered with RegisterFlags, then validates them
+func LoadSettings(flags *pflag.FlagSet) (*Settings, error) {
+	settings := DefaultSettings()
+
+	path := os.Getenv("LANGEKKO_CONFIG")
+	if flags != nil {
+		if flagPath, _ := flags.GetString("config"); flagPath != "" {
+			path = flagPath
+		}
+	}
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		// unknown keys are reported, so that a misspelled setting does not
+		// silently keep its default
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(settings); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+
+	if err := settings.applyEnv(); err != nil {
+		return nil, err
+	}
+	if flags != nil {
+		settings.applyFlags(flags)
+	}
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (s *Settings) applyEnv() error {
+	stringVars := map[string]*string{
+		"TELEGRAM_TOKEN":         &s.Telegram.Token,
+		"OPENAI_API_TOKEN":       &s.OpenAI.APIToken,
+		"OPENAI_CHAT_MODEL":      &s.OpenAI.ChatModel,
+		"OPENAI_TTS_MODEL":       &s.OpenAI.TTSModel,
+		"OPENAI_TTS_VOICE":       &s.OpenAI.TTSVoice,
+		"SQLITE_PATH":            &s.Database.SQLitePath,
+		"LANGEKKO_ADDR":          &s.HTTP.Addr,
+		"LOG_LEVEL":              &s.Log.Level,
+		"LOG_FORMAT":             &s.Log.Format,
+		"LANGEKKO_TEMPLATES_DIR": &s.Templates.OverrideDir,
+	}
+	for name, target := range stringVars {
+		if value, ok := os.LookupEnv(name); ok && value != "" {
+			*target = value
+		}
+	}
+
+	if value := os.Getenv("LANGEKKO_PORT"); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("LANGEKKO_PORT: %w", err)
+		}
+		s.HTTP.Port = port
+	}
+	if value := os.Getenv("ALLOWED_TELEGRAM_USER_IDS"); value != "" {
+		ids, err := parseUserIDs(value)
+		if err != nil {
+			return fmt.Errorf("ALLOWED_TELEGRAM_USER_IDS: %w", err)
+		}
+		s.Telegram.AllowedUserIDs = ids
+	}
+	if value := os.Getenv("CACHE_CLEAN_INTERVAL_HOURS"); value != "" {
+		hours, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("CACHE_CLEAN_INTERVAL_HOURS: %w", err)
+		}
+		s.Cache.CleanInterval = time.Duration(hours) * time.Hour
+	}
+	if value := os.Getenv("CACHE_TTL_HOURS"); value != "" {
+		hours, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("CACHE_TTL_HOURS: %w", err)
+		}
+		s.Cache.TTL = time.Duration(hours) * time.Hour
+	}
+	if value := os.Getenv("OTEL_TRACING_ENABLED"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("OTEL_TRACING_ENABLED: %w", err)
+		}
+		s.Tracing.Enabled = enabled
+	}
+	return nil
+}
+
+func (s *Settings) applyFlags(flags *pflag.FlagSet) {
+	stringFlags := map[string]*string{
+		"sqlite-path":   &s.Database.SQLitePath,
+		"addr":          &s.HTTP.Addr,
+		"chat-model":    &s.OpenAI.ChatModel,
+		"tts-voice":     &s.OpenAI.TTSVoice,
+		"log-level":     &s.Log.Level,
+		"log-format":    &s.Log.Format,
+		"templates-dir": &s.Templates.OverrideDir,
+	}
+	for name, target := range stringFlags {
+		if flags.Changed(name) {
+			*target, _ = flags.GetString(name)
+		}
+	}
+	if flags.Changed("port") {
+		s.HTTP.Port, _ = flags.GetInt("port")
+	}
+	if flags.Changed("tracing") {
+		s.Tracing.Enabled, _ = flags.GetBool("tracing")
+	}
+}
+
+func parseUserIDs(value string) ([]int64, error) {
+	var ids []int64
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Validate reports every invalid setting at once
+func (s *Settings) Validate() error {
+	var errs []error
+	if s.OpenAI.ChatModel == "" {
+		errs = append(errs, errors.New("openai.chat_model must not be empty"))
+	}
+	if s.OpenAI.TTSVoice == "" {
+		errs = append(errs, errors.New("openai.tts_voice must not be empty"))
+	}
+	if s.Database.SQLitePath == "" {
+		errs = append(errs, errors.New("database.sqlite_path must not be empty"))
+	}
+	if s.HTTP.Port <= 0 || s.HTTP.Port > 65535 {
+		errs = append(errs, fmt.Errorf("http.port must be between 1 and 65535, got %d", s.HTTP.Port))
+	}
+	if s.Cache.CleanInterval <= 0 {
+		errs = append(errs, fmt.Errorf("cache.clean_interval must be positive, got %s", s.Cache.CleanInterval))
+	}
+	if s.Cache.TTL <= 0 {
+		errs = append(errs, fmt.Errorf("cache.ttl must be positive, got %s", s.Cache.TTL))
+	}
+	if len(s.Speech.Speeds) == 0 {
+		errs = append(errs, errors.New("speech.speeds must contain at least one speed"))
+	}
+	speeds := append([]SpeechSpeed{{Label: "default", Value: s.Speech.DefaultSpeed}}, s.Speech.Speeds...)
+	for _, speed := range speeds {
+		// the OpenAI speech API accepts speeds from 0.25 to 4.0
+		if speed.Value < 0.25 || speed.Value > 4.0 {
+			errs = append(errs, fmt.Errorf("speech speed %q must be between 0.25 and 4.0, got %.2f", speed.Label, speed.Value))
+		}
+	}
+	if len(s.Chat.Scenarios) == 0 {
+		errs = append(errs, errors.New("chat.scenarios must contain at least one scenario"))
+	}
+	scenarioIDs := make(map[string]bool)
+	for _, scenario := range s.Chat.Scenarios {
+		// the ID is part of the callback data, which Telegram limits to 64 bytes
+		if scenario.ID == "" || len(scenario.ID) > 32 || strings.Contains(scenario.ID, ":") {
+			errs = append(errs, fmt.Errorf("chat scenario %q must have an id of 1 to 32 characters without colons", scenario.Label))
+		}
+		if scenarioIDs[scenario.ID] {
+			errs = append(errs, fmt.Errorf("chat scenario id %q is not unique", scenario.ID))
+		}
+		scenarioIDs[scenario.ID] = true
+	}
+	if s.Chat.HistoryWindow <= 0 {
+		errs = append(errs, fmt.Errorf("chat.history_window must be positive, got %d", s.Chat.HistoryWindow))
+	}
+	if s.WordOfDay.CheckInterval <= 0 {
+		errs = append(errs, fmt.Errorf("word_of_day.check_interval must be positive, got %s", s.WordOfDay.CheckInterval))
+	}
+	if _, err := time.Parse("15:04", s.WordOfDay.DefaultTime); err != nil {
+		errs = append(errs, fmt.Errorf("word_of_day.default_time must be HH:MM, got %q", s.WordOfDay.DefaultTime))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %w", err))
+	}
+	if s.Log.Format != "text" && s.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("log.format must be text or json, got %q", s.Log.Format))
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateForTelegram additionally checks the settings required to run the bot
+func (s *Settings) ValidateForTelegram() error {
+	var errs []error
+	if s.Telegram.Token == "" {
+		errs = append(errs, errors.New("telegram.token (TELEGRAM_TOKEN) is required"))
+	}
+	if len(s.Telegram.AllowedUserIDs) == 0 {
+		errs = append(errs, errors.New("telegram.allowed_user_ids (ALLOWED_TELEGRAM_USER_IDS) is required"))
+	}
+	if s.OpenAI.APIToken == "" {
+		errs = append(errs, errors.New("openai.api_token (OPENAI_API_TOKEN) is required"))
+	}
+	return errors.Join(errs...)
+}
+
+// Masked returns a copy of the settings with secrets hidden, for display
+func (s *Settings) Masked() *Settings {
+	masked := *s
+	masked.Telegram.Token = mask(s.Telegram.Token)
+	masked.OpenAI.APIToken = mask(s.OpenAI.APIToken)
+	return &masked
+}
+
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return "********"
+	}
+	return secret[:4] + "********"
+}
+
+// YAML renders the settings in the config file format
+func (s *Settings) YAML() (string, error) {
+	content, err := yaml.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// HTTPAddress returns the host:port the HTTP server listens on
+func (s *Settings) HTTPAddress() string {
+	return net.JoinHostPort(s.HTTP.Addr, strconv.Itoa(s.HTTP.Port))
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"gopkg.in/yaml.v3"
+)
+
+// TuningMetadata holds per tuning file request settings. Zero values mean
+// "use the default".
+type TuningMetadata struct {
+	// Version identifies the prompt revision, e.g. for comparing evaluations
+	Version     string   `yaml:"version"`
+	Model       string   `yaml:"model"`
+	Temperature *float32 `yaml:"temperature"`
+	MaxTokens   int      `yaml:"max_tokens"`
+}
+
+// yamlTuning is the structured tuning file format:
+//
+//	version: "2"
+//	model: gpt-4o
+//	temperature: 0.2
+//	max_tokens: 400
+//	messages:
+//	  - role: user
+//	    content: zijn
+//	  - role: assistant
+//	    content: |-
+//	      zijn - was - geweest
+type yamlTuning struct {
+	TuningMetadata `yaml:",inline"`
+	Messages       []yamlMessage `yaml:"messages"`
+}
+
+type yamlMessage struct {
+	Role    string `yaml:"role"`
+	Content string `yaml:"content"`
+}
+
+// tuningFileExtensions are the supported tuning file formats
+var tuningFileExtensions = []string{".txt", ".yaml", ".yml"}
+
+// tuningLanguage returns the language of a <language>.<extension> tuning file name
+func tuningLanguage(name string) (string, bool) {
+	for _, extension := range tuningFileExtensions {
+		if strings.HasSuffix(name, extension) {
+			return strings.TrimSuffix(name, extension), true
+		}
+	}
+	return "", false
+}
+
+// parseTuningFile parses a tuning file in the line based "role: content"
+// format (.txt) or the structured YAML format (.yaml, .yml)
+func parseTuningFile(name string, content []byte) ([]openai.ChatCompletionMessage, TuningMetadata, error) {
+	if strings.HasSuffix(name, ".txt") {
+		return getChatCompletionMessages(content), TuningMetadata{}, nil
+	}
+
+	var tuning yamlTuning
+	if err := yaml.Unmarshal(content, &tuning); err != nil {
+		return nil, TuningMetadata{}, fmt.Errorf("%s: %w", name, err)
+	}
+	messages := make([]openai.ChatCompletionMessage, 0, len(tuning.Messages))
+	for _, message := range tuning.Messages {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    strings.TrimSpace(message.Role),
+			Content: strings.TrimSpace(message.Content),
+		})
+	}
+	return messages, tuning.TuningMetadata, nil
+}
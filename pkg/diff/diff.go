@@ -0,0 +1,83 @@
+// Package diff computes the differences between two sequences of words or
+// characters, e.g. a learner's sentence and its correction
+package diff
+
+import "strings"
+
+type Kind int
+
+const (
+	Equal Kind = iota
+	Delete
+	Insert
+)
+
+// Op is a token that is kept, removed from the first sequence or inserted
+// from the second one
+type Op struct {
+	Kind Kind
+	Text string
+}
+
+// Strings returns the operations turning a into b, keeping their longest
+// common subsequence. Deletions come before insertions where a token is replaced.
+func Strings(a, b []string) []Op {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]Op, 0, max(len(a), len(b)))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, Op{Kind: Equal, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, Op{Kind: Delete, Text: a[i]})
+			i++
+		default:
+			ops = append(ops, Op{Kind: Insert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, Op{Kind: Delete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, Op{Kind: Insert, Text: b[j]})
+	}
+	return ops
+}
+
+// Words diffs the whitespace separated words of a and b
+func Words(a, b string) []Op {
+	return Strings(strings.Fields(a), strings.Fields(b))
+}
+
+// Chars diffs the characters of a and b
+func Chars(a, b string) []Op {
+	return Strings(strings.Split(a, ""), strings.Split(b, ""))
+}
+
+// Changed reports whether any operation is not Equal
+func Changed(ops []Op) bool {
+	for _, op := range ops {
+		if op.Kind != Equal {
+			return true
+		}
+	}
+	return false
+}
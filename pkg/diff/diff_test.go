@@ -0,0 +1,114 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+// render writes the operations as "=kept -deleted +inserted"
+func render(ops []Op) string {
+	tokens := make([]string, 0, len(ops))
+	for _, op := range ops {
+		switch op.Kind {
+		case Equal:
+			tokens = append(tokens, "="+op.Text)
+		case Delete:
+			tokens = append(tokens, "-"+op.Text)
+		case Insert:
+			tokens = append(tokens, "+"+op.Text)
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"both empty", "", "", ""},
+		{"equal", "de kat slaapt", "de kat slaapt", "=de =kat =slaapt"},
+		{"replaced word deletes first", "I has a cat", "I have a cat", "=I -has +have =a =cat"},
+		{"inserted word", "ik naar huis", "ik ga naar huis", "=ik +ga =naar =huis"},
+		{"deleted word", "ik ga naar naar huis", "ik ga naar huis", "=ik =ga =naar -naar =huis"},
+		{"first empty", "", "goede morgen", "+goede +morgen"},
+		{"second empty", "goede morgen", "", "-goede -morgen"},
+		{"extra whitespace", "  de   kat ", "de kat", "=de =kat"},
+		{"reordered words", "morgen ga ik", "ik ga morgen", "-morgen -ga =ik +ga +morgen"},
+		{"case matters", "Huis", "huis", "-Huis +huis"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := render(Words(tt.a, tt.b)); got != tt.want {
+				t.Errorf("Words(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChars(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"both empty", "", "", ""},
+		{"missing letter", "hus", "huis", "=h =u +i =s"},
+		{"multibyte runes are single tokens", "hüs", "huis", "=h -ü +u +i =s"},
+		{"cyrillic", "малоко", "молоко", "=м -а +о =л =о =к =о"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := render(Chars(tt.a, tt.b)); got != tt.want {
+				t.Errorf("Chars(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringsKeepsLongestCommonSubsequence(t *testing.T) {
+	a := strings.Split("abcbdab", "")
+	b := strings.Split("bdcaba", "")
+	var kept int
+	for _, op := range Strings(a, b) {
+		if op.Kind == Equal {
+			kept++
+		}
+	}
+	if kept != 4 {
+		t.Errorf("kept %d tokens, want the 4 of the longest common subsequence", kept)
+	}
+}
+
+func TestStringsRebuildsBoth(t *testing.T) {
+	a := strings.Fields("the quick brown fox jumps over the lazy dog")
+	b := strings.Fields("a quick red fox jumped over the dog today")
+	var fromA, fromB []string
+	for _, op := range Strings(a, b) {
+		if op.Kind != Insert {
+			fromA = append(fromA, op.Text)
+		}
+		if op.Kind != Delete {
+			fromB = append(fromB, op.Text)
+		}
+	}
+	if strings.Join(fromA, " ") != strings.Join(a, " ") {
+		t.Errorf("kept and deleted tokens = %q, want %q", fromA, a)
+	}
+	if strings.Join(fromB, " ") != strings.Join(b, " ") {
+		t.Errorf("kept and inserted tokens = %q, want %q", fromB, b)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	if Changed(nil) {
+		t.Error("Changed(nil) = true, want false")
+	}
+	if Changed(Words("de kat", "de kat")) {
+		t.Error("Changed for equal words = true, want false")
+	}
+	if !Changed(Words("de kat", "de hond")) {
+		t.Error("Changed for different words = false, want true")
+	}
+}
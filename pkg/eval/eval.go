@@ -0,0 +1,206 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"language-learning-bot/pkg/answer"
+	"language-learning-bot/pkg/bot"
+	"language-learning-bot/pkg/config"
+	openai_api "language-learning-bot/pkg/openai"
+
+	"github.com/sashabaranov/go-openai"
+	"gopkg.in/yaml.v3"
+)
+
+// Suite is a set of evaluation cases, read from a YAML file
+type Suite struct {
+	Cases []Case `yaml:"cases"`
+}
+
+// Case is a single input sent for a language and help type, with the
+// properties the answer is expected to have
+type Case struct {
+	Name     string `yaml:"name"`
+	Language string `yaml:"language"`
+	HelpType string `yaml:"help_type"`
+	// Level is the CEFR level of the learner the prompt is rendered for, if set
+	Level  string     `yaml:"level"`
+	Input  string     `yaml:"input"`
+	Expect Assertions `yaml:"expect"`
+}
+
+// Assertions are checked against the answer. Text comparisons are case-insensitive.
+type Assertions struct {
+	// Contains lists strings that must all appear in the answer, e.g. the
+	// expected target-language word
+	Contains []string `yaml:"contains"`
+	// NotContains lists strings that must not appear in the answer
+	NotContains []string `yaml:"not_contains"`
+	// Matches lists regular expressions the answer must match
+	Matches []string `yaml:"matches"`
+	// MinExamples is the minimum number of "1. ..." numbered example lines
+	MinExamples int `yaml:"min_examples"`
+	// NoEnglishInExamples fails the case if a numbered example looks English
+	NoEnglishInExamples bool `yaml:"no_english_in_examples"`
+}
+
+// Variant is one prompt and model combination the suite is run against
+type Variant struct {
+	Label  string
+	Config *config.Config
+	// Model, when set, replaces the model chosen by the tuning metadata
+	Model string
+}
+
+// Result is the outcome of a case for a variant
+type Result struct {
+	Case     Case
+	Variant  string
+	Version  string
+	Answer   string
+	Failures []string
+	Duration time.Duration
+	Err      error
+}
+
+// Passed reports whether the answer was produced and met every assertion
+func (r Result) Passed() bool {
+	return r.Err == nil && len(r.Failures) == 0
+}
+
+// LoadSuite reads a suite from a YAML file
+func LoadSuite(path string) (*Suite, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var suite Suite
+	if err := yaml.Unmarshal(content, &suite); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for i, c := range suite.Cases {
+		if c.Language == "" || c.HelpType == "" || c.Input == "" {
+			return nil, fmt.Errorf("case %d (%s): language, help_type and input are required", i+1, c.Name)
+		}
+		if c.Name == "" {
+			suite.Cases[i].Name = fmt.Sprintf("%s/%s/%s", c.HelpType, c.Language, c.Input)
+		}
+	}
+	return &suite, nil
+}
+
+// Run sends every case of the suite to the provider for every variant
+func Run(ctx context.Context, openaiClient *openai.Client, suite *Suite, variants []Variant) []Result {
+	var results []Result
+	for _, variant := range variants {
+		for _, c := range suite.Cases {
+			results = append(results, runCase(ctx, openaiClient, c, variant))
+		}
+	}
+	return results
+}
+
+func runCase(ctx context.Context, openaiClient *openai.Client, c Case, variant Variant) Result {
+	result := Result{Case: c, Variant: variant.Label}
+
+	request, metadata, err := bot.BuildGPTRequest(variant.Config, c.HelpType, c.Language, c.Level, c.Input)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Version = metadata.Version
+	if variant.Model != "" {
+		request.Model = variant.Model
+	}
+
+	start := time.Now()
+	content, err := openai_api.GetGPTResponse(ctx, openaiClient, request)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if structured, err := answer.Parse(content); err == nil {
+		content = structured.Render()
+	}
+	result.Answer = content
+	result.Failures = Check(c.Expect, content)
+	return result
+}
+
+var numberedLineRegex = regexp.MustCompile(`^\s*[0-9]+\.\s+(.*)$`)
+
+// englishMarkers are frequent English words that are not also words in any
+// of the supported target languages, unlike e.g. "will" (German), "and"
+// (Estonian) or "have" (Dutch)
+var englishMarkers = map[string]bool{
+	"the": true, "you": true, "with": true, "this": true, "that": true,
+	"what": true, "are": true, "for": true, "from": true, "they": true,
+	"would": true, "your": true,
+}
+
+// Check returns a description of every assertion the answer fails
+func Check(expect Assertions, answer string) []string {
+	var failures []string
+	lower := strings.ToLower(answer)
+
+	for _, s := range expect.Contains {
+		if !strings.Contains(lower, strings.ToLower(s)) {
+			failures = append(failures, fmt.Sprintf("does not contain %q", s))
+		}
+	}
+	for _, s := range expect.NotContains {
+		if strings.Contains(lower, strings.ToLower(s)) {
+			failures = append(failures, fmt.Sprintf("contains %q", s))
+		}
+	}
+	for _, pattern := range expect.Matches {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("invalid regexp %q: %v", pattern, err))
+			continue
+		}
+		if !re.MatchString(answer) {
+			failures = append(failures, fmt.Sprintf("does not match %q", pattern))
+		}
+	}
+
+	examples := numberedExamples(answer)
+	if len(examples) < expect.MinExamples {
+		failures = append(failures, fmt.Sprintf("has %d numbered examples, expected at least %d", len(examples), expect.MinExamples))
+	}
+	if expect.NoEnglishInExamples {
+		for i, example := range examples {
+			if word, ok := englishWord(example); ok {
+				failures = append(failures, fmt.Sprintf("example %d looks English (%q)", i+1, word))
+			}
+		}
+	}
+	return failures
+}
+
+func numberedExamples(answer string) []string {
+	var examples []string
+	for _, line := range strings.Split(answer, "\n") {
+		if match := numberedLineRegex.FindStringSubmatch(line); match != nil {
+			examples = append(examples, match[1])
+		}
+	}
+	return examples
+}
+
+func englishWord(text string) (string, bool) {
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !('a' <= r && r <= 'z') && r != '\''
+	}) {
+		if englishMarkers[word] {
+			return word, true
+		}
+	}
+	return "", false
+}
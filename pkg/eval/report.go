@@ -0,0 +1,103 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteReport prints the result of every case, the failures of failed cases
+// and a pass rate summary per variant, so variants can be compared
+func WriteReport(w io.Writer, results []Result, verbose bool) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VARIANT\tVERSION\tCASE\tRESULT\tDURATION")
+	for _, result := range results {
+		status := "PASS"
+		if !result.Passed() {
+			status = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", result.Variant, orDash(result.Version), result.Case.Name, status, result.Duration.Round(time.Millisecond))
+	}
+	tw.Flush()
+
+	for _, result := range results {
+		if result.Passed() && !verbose {
+			continue
+		}
+		fmt.Fprintf(w, "\n[%s] %s\n", result.Variant, result.Case.Name)
+		if result.Err != nil {
+			fmt.Fprintf(w, "  error: %v\n", result.Err)
+		}
+		for _, failure := range result.Failures {
+			fmt.Fprintf(w, "  - %s\n", failure)
+		}
+		if result.Answer != "" {
+			fmt.Fprintf(w, "  answer:\n    %s\n", strings.ReplaceAll(result.Answer, "\n", "\n    "))
+		}
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VARIANT\tPASSED\tTOTAL\tRATE\tAVG DURATION")
+	for _, summary := range summarize(results) {
+		rate := 0.0
+		if summary.total > 0 {
+			rate = 100 * float64(summary.passed) / float64(summary.total)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.0f%%\t%s\n", summary.variant, summary.passed, summary.total, rate, summary.averageDuration().Round(time.Millisecond))
+	}
+	tw.Flush()
+}
+
+type variantSummary struct {
+	variant  string
+	passed   int
+	total    int
+	duration time.Duration
+}
+
+func (s variantSummary) averageDuration() time.Duration {
+	if s.total == 0 {
+		return 0
+	}
+	return s.duration / time.Duration(s.total)
+}
+
+// summarize aggregates results per variant, keeping the order variants were run in
+func summarize(results []Result) []variantSummary {
+	var summaries []variantSummary
+	index := make(map[string]int)
+	for _, result := range results {
+		i, ok := index[result.Variant]
+		if !ok {
+			i = len(summaries)
+			index[result.Variant] = i
+			summaries = append(summaries, variantSummary{variant: result.Variant})
+		}
+		summaries[i].total++
+		summaries[i].duration += result.Duration
+		if result.Passed() {
+			summaries[i].passed++
+		}
+	}
+	return summaries
+}
+
+// Failed reports whether any result did not pass
+func Failed(results []Result) bool {
+	for _, result := range results {
+		if !result.Passed() {
+			return true
+		}
+	}
+	return false
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
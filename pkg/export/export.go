@@ -0,0 +1,148 @@
+// Package export writes the data of a user, such as the lookup history and
+// saved words, as CSV or JSON tables
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	storage "language-learning-bot/pkg/storage"
+)
+
+// Kinds are the tables that can be exported
+var Kinds = []string{"history", "vocabulary", "stats"}
+
+// Formats are the file formats tables can be written in
+var Formats = []string{"csv", "json"}
+
+// Table is exported data with a value per column in each row. Values are
+// strings, numbers, times or lists of strings.
+type Table struct {
+	Name    string
+	Columns []string
+	Rows    [][]any
+}
+
+// Build reads the table of the kind for the user
+func Build(ctx context.Context, db *sql.DB, userID int, kind string) (Table, error) {
+	switch kind {
+	case "history":
+		return historyTable(ctx, db, userID)
+	case "vocabulary":
+		return vocabularyTable(ctx, db, userID)
+	case "stats":
+		return statsTable(ctx, db, userID)
+	}
+	return Table{}, fmt.Errorf("unknown export %q, expected one of %s", kind, strings.Join(Kinds, ", "))
+}
+
+func historyTable(ctx context.Context, db *sql.DB, userID int) (Table, error) {
+	history, err := storage.GetQueryHistory(ctx, db, userID)
+	if err != nil {
+		return Table{}, err
+	}
+	table := Table{Name: "history", Columns: []string{"timestamp", "language", "help_type", "word"}}
+	for _, entry := range history {
+		table.Rows = append(table.Rows, []any{entry.Timestamp, entry.Language, entry.HelpType, entry.Word})
+	}
+	return table, nil
+}
+
+func vocabularyTable(ctx context.Context, db *sql.DB, userID int) (Table, error) {
+	words, err := storage.GetVocabularyExport(ctx, db, userID, "")
+	if err != nil {
+		return Table{}, err
+	}
+	table := Table{Name: "vocabulary", Columns: []string{"language", "word", "tags", "translation", "examples", "added_at"}}
+	for _, word := range words {
+		tags := word.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		table.Rows = append(table.Rows, []any{word.Language, word.Word, tags, word.Translation, word.Examples, word.AddedAt})
+	}
+	return table, nil
+}
+
+func statsTable(ctx context.Context, db *sql.DB, userID int) (Table, error) {
+	stats, err := storage.GetReviewStats(ctx, db, userID)
+	if err != nil {
+		return Table{}, err
+	}
+	table := Table{Name: "stats", Columns: []string{"language", "activity", "answered", "score", "accuracy"}}
+	for _, s := range stats {
+		accuracy := 0.0
+		if s.Answered > 0 {
+			accuracy = s.Score / float64(s.Answered)
+		}
+		table.Rows = append(table.Rows, []any{s.Language, s.Activity, s.Answered, s.Score, accuracy})
+	}
+	return table, nil
+}
+
+// Write writes the table in the format
+func Write(w io.Writer, table Table, format string) error {
+	switch format {
+	case "csv":
+		return WriteCSV(w, table)
+	case "json":
+		return WriteJSON(w, table)
+	}
+	return fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// WriteCSV writes the table with a header row. Lists are joined with spaces.
+func WriteCSV(w io.Writer, table Table) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(table.Columns); err != nil {
+		return err
+	}
+	for _, row := range table.Rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			record[i] = csvValue(value)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, " ")
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// WriteJSON writes the table as an array with an object per row
+func WriteJSON(w io.Writer, table Table) error {
+	objects := make([]map[string]any, 0, len(table.Rows))
+	for _, row := range table.Rows {
+		object := make(map[string]any, len(table.Columns))
+		for i, column := range table.Columns {
+			object[column] = row[i]
+		}
+		objects = append(objects, object)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(objects)
+}
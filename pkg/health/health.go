@@ -0,0 +1,146 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"language-learning-bot/pkg/config"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// HeartbeatTimeout is how long the update loop may stay silent before it
+	// is considered dead; it is longer than a getUpdates long poll
+	HeartbeatTimeout = 2 * time.Minute
+	// ProviderProbeTTL is how long a provider probe result is reused
+	ProviderProbeTTL = 5 * time.Minute
+	// checkTimeout bounds each individual readiness check
+	checkTimeout = 5 * time.Second
+)
+
+// Checker runs liveness and readiness checks for the bot
+type Checker struct {
+	db           *sql.DB
+	openaiClient *openai.Client
+	configStore  *config.Store
+
+	lastHeartbeat atomic.Int64
+
+	probeMu        sync.Mutex
+	lastProbe      time.Time
+	lastProbeError error
+}
+
+// NewChecker creates a Checker for the given dependencies
+func NewChecker(db *sql.DB, openaiClient *openai.Client, configStore *config.Store) *Checker {
+	checker := &Checker{
+		db:           db,
+		openaiClient: openaiClient,
+		configStore:  configStore,
+	}
+	checker.Heartbeat()
+	return checker
+}
+
+// Heartbeat records that the update loop is alive, after every poll for
+// updates that completed
+func (c *Checker) Heartbeat() {
+	c.lastHeartbeat.Store(time.Now().UnixNano())
+}
+
+// CheckUpdateLoop returns an error when the update loop has not sent a
+// heartbeat within HeartbeatTimeout
+func (c *Checker) CheckUpdateLoop() error {
+	last := time.Unix(0, c.lastHeartbeat.Load())
+	if time.Since(last) > HeartbeatTimeout {
+		return fmt.Errorf("no heartbeat from update loop since %s", last.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CheckDatabase pings the database
+func (c *Checker) CheckDatabase(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
+// CheckTemplates verifies that the active prompt templates and tunings are loaded and valid
+func (c *Checker) CheckTemplates() error {
+	active := c.configStore.Get()
+	if active == nil {
+		return fmt.Errorf("no config loaded")
+	}
+	return active.Validate()
+}
+
+// CheckProvider verifies the OpenAI API is reachable. Probe results are
+// cached for ProviderProbeTTL so frequent readiness probes do not hit the API.
+func (c *Checker) CheckProvider(ctx context.Context) error {
+	c.probeMu.Lock()
+	defer c.probeMu.Unlock()
+
+	if !c.lastProbe.IsZero() && time.Since(c.lastProbe) < ProviderProbeTTL {
+		return c.lastProbeError
+	}
+
+	_, err := c.openaiClient.ListModels(ctx)
+	c.lastProbe = time.Now()
+	c.lastProbeError = err
+	return err
+}
+
+// Readiness runs all readiness checks and returns the result of each by name
+func (c *Checker) Readiness(ctx context.Context) map[string]error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	return map[string]error{
+		"database":    c.CheckDatabase(ctx),
+		"templates":   c.CheckTemplates(),
+		"provider":    c.CheckProvider(ctx),
+		"update_loop": c.CheckUpdateLoop(),
+	}
+}
+
+type response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// LivenessHandler serves /healthz, failing only when the update loop is stuck
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, map[string]error{"update_loop": c.CheckUpdateLoop()})
+	})
+}
+
+// ReadinessHandler serves /readyz, failing when any dependency is unavailable
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, c.Readiness(r.Context()))
+	})
+}
+
+func writeResponse(w http.ResponseWriter, checks map[string]error) {
+	resp := response{Status: "ok", Checks: make(map[string]string, len(checks))}
+	status := http.StatusOK
+	for name, err := range checks {
+		if err != nil {
+			resp.Status = "unavailable"
+			resp.Checks[name] = err.Error()
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		resp.Checks[name] = "ok"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
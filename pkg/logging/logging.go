@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	correlationIDKey contextKey = iota
+	userIDKey
+	commandKey
+	helpTypeKey
+)
+
+// level is shared by the default handler so it can be inspected by Redact
+var level = new(slog.LevelVar)
+
+// Setup installs the default slog logger. levelName is one of debug, info,
+// warn or error; format is either "text" or "json".
+func Setup(levelName, format string) error {
+	if levelName == "" {
+		levelName = "info"
+	}
+	if err := level.UnmarshalText([]byte(levelName)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", levelName, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	return nil
+}
+
+// DebugEnabled reports whether debug logging is on
+func DebugEnabled() bool {
+	return level.Level() <= slog.LevelDebug
+}
+
+// Redact hides user supplied text unless debug logging is enabled
+func Redact(text string) string {
+	if DebugEnabled() {
+		return text
+	}
+	return fmt.Sprintf("[redacted %d chars]", len([]rune(text)))
+}
+
+// NewCorrelationID returns a random identifier for a single update
+func NewCorrelationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithCorrelationID returns a context whose log lines carry the correlation ID
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, correlationID)
+}
+
+// WithUserID returns a context whose log lines carry the Telegram user ID
+func WithUserID(ctx context.Context, userID int64) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// WithCommand returns a context whose log lines carry the bot command
+func WithCommand(ctx context.Context, command string) context.Context {
+	return context.WithValue(ctx, commandKey, command)
+}
+
+// WithHelpType returns a context whose log lines carry the help type
+func WithHelpType(ctx context.Context, helpType string) context.Context {
+	return context.WithValue(ctx, helpTypeKey, helpType)
+}
+
+// CorrelationID returns the correlation ID stored in ctx, if any
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
+}
+
+// contextHandler adds the request attributes stored in the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id, ok := ctx.Value(correlationIDKey).(string); ok {
+		record.AddAttrs(slog.String("correlation_id", id))
+	}
+	if userID, ok := ctx.Value(userIDKey).(int64); ok {
+		record.AddAttrs(slog.Int64("user_id", userID))
+	}
+	if command, ok := ctx.Value(commandKey).(string); ok {
+		record.AddAttrs(slog.String("command", command))
+	}
+	if helpType, ok := ctx.Value(helpTypeKey).(string); ok {
+		record.AddAttrs(slog.String("help_type", helpType))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
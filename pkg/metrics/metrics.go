@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "langekko"
+
+var (
+	// UpdatesTotal counts incoming Telegram updates by type
+	// (message, command, callback_query, other).
+	UpdatesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_total",
+		Help:      "Telegram updates received, by update type.",
+	}, []string{"type"})
+
+	// CommandsTotal counts bot commands by command name, "other" for
+	// unknown commands.
+	CommandsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "commands_total",
+		Help:      "Bot commands handled, by command.",
+	}, []string{"command"})
+
+	// HelpTypeRequestsTotal counts processed queries by help type.
+	HelpTypeRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "help_type_requests_total",
+		Help:      "Queries processed, by help type.",
+	}, []string{"help_type"})
+
+	// CacheRequestsTotal counts response cache lookups by result (hit or miss).
+	CacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cached response lookups, by result.",
+	}, []string{"result"})
+
+	// OpenAIRequestDuration observes chat completion latency by model.
+	OpenAIRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "openai_request_duration_seconds",
+		Help:      "Latency of OpenAI chat completion requests, by model.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 4, 8, 16, 32, 64},
+	}, []string{"model"})
+
+	// OpenAIErrorsTotal counts failed OpenAI requests by model.
+	OpenAIErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "openai_errors_total",
+		Help:      "Failed OpenAI requests, by model.",
+	}, []string{"model"})
+
+	// OpenAITokensTotal counts consumed tokens by model and kind (prompt or completion).
+	OpenAITokensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "openai_tokens_total",
+		Help:      "OpenAI tokens consumed, by model and kind.",
+	}, []string{"model", "kind"})
+
+	// TTSRequestDuration observes text-to-speech latency.
+	TTSRequestDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tts_request_duration_seconds",
+		Help:      "Latency of OpenAI text-to-speech requests.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 4, 8, 16, 32},
+	})
+
+	// DBQueryDuration observes SQLite query latency by query name.
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of database queries, by query.",
+		Buckets:   []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 1},
+	}, []string{"query"})
+
+	// GoroutinesInFlight tracks update handler goroutines currently running.
+	GoroutinesInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "goroutines_in_flight",
+		Help:      "Update handler goroutines currently running.",
+	})
+)
+
+// ObserveDBQuery returns a function that records the elapsed time of the
+// named query when called, meant to be deferred at the top of a storage call.
+func ObserveDBQuery(query string) func() {
+	start := time.Now()
+	return func() {
+		DBQueryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler returns the HTTP handler serving the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -2,21 +2,46 @@ package openai_api
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"time"
 
-	"log"
+	"language-learning-bot/pkg/logging"
+	"language-learning-bot/pkg/metrics"
+	"language-learning-bot/pkg/tracing"
 
 	openai "github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// zeroTemperature stands in for a temperature of 0. go-openai tags
+// ChatCompletionRequest.Temperature with json:"temperature,omitempty", so a
+// temperature of 0 is left out of the request and the API uses its default
+// of 1 instead. Keep this tiny positive value rather than 0.
+const zeroTemperature = 1e-6
+
 type GPTRequest struct {
+	Model string
+	// Temperature is left to the API default when nil
+	Temperature *float32
+	// MaxTokens is unlimited when zero
+	MaxTokens              int
 	Prompt                 string
 	WordOrPhrase           string
 	ChatCompletionMessages []openai.ChatCompletionMessage
+	// Schema, when set, makes the model answer with JSON following the schema
+	Schema     *jsonschema.Definition
+	SchemaName string
 }
 
-func GetGPTResponse(ctx context.Context, openaiClient *openai.Client, req GPTRequest) (string, error) {
-	// Refactored implementation
+func GetGPTResponse(ctx context.Context, openaiClient *openai.Client, req GPTRequest) (response string, err error) {
+	model := req.Model
+	ctx, span := tracing.Start(ctx, "openai.GetGPTResponse", attribute.String("model", model))
+	defer func() { tracing.End(span, err) }()
+
 	promptMessages := []openai.ChatCompletionMessage{
 		{Role: openai.ChatMessageRoleSystem, Content: req.Prompt},
 	}
@@ -27,29 +52,80 @@ func GetGPTResponse(ctx context.Context, openaiClient *openai.Client, req GPTReq
 		Content: req.WordOrPhrase,
 	})
 
-	resp, err := openaiClient.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model:    openai.GPT4o,
-		Messages: promptAndMessages,
-	})
+	start := time.Now()
+	request := openai.ChatCompletionRequest{
+		Model:     model,
+		Messages:  promptAndMessages,
+		MaxTokens: req.MaxTokens,
+	}
+	if req.Temperature != nil {
+		request.Temperature = *req.Temperature
+		if request.Temperature == 0 {
+			// the client omits a zero temperature, which leaves the API
+			// default of 1, so send the closest temperature it does not omit
+			request.Temperature = zeroTemperature
+		}
+	}
+	if req.Schema != nil {
+		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   req.SchemaName,
+				Schema: req.Schema,
+				Strict: true,
+			},
+		}
+	}
+	resp, err := openaiClient.CreateChatCompletion(ctx, request)
+	metrics.OpenAIRequestDuration.WithLabelValues(model).Observe(time.Since(start).Seconds())
 
 	if err != nil {
+		metrics.OpenAIErrorsTotal.WithLabelValues(model).Inc()
 		return "", err
 	}
+	metrics.OpenAITokensTotal.WithLabelValues(model, "prompt").Add(float64(resp.Usage.PromptTokens))
+	metrics.OpenAITokensTotal.WithLabelValues(model, "completion").Add(float64(resp.Usage.CompletionTokens))
+	span.SetAttributes(
+		attribute.Int("tokens.prompt", resp.Usage.PromptTokens),
+		attribute.Int("tokens.completion", resp.Usage.CompletionTokens),
+	)
 
+	if len(resp.Choices) == 0 {
+		return "", errors.New("no choices in the response")
+	}
+	if refusal := resp.Choices[0].Message.Refusal; refusal != "" {
+		return "", fmt.Errorf("model refused to answer: %s", refusal)
+	}
 	return resp.Choices[0].Message.Content, nil
 }
 
-func GetTTSResponse(ctx context.Context, openaiClient *openai.Client, speechSpeed float64, req string) ([]byte, error) {
+type TTSRequest struct {
+	Model string
+	Voice string
+	Speed float64
+	Text  string
+}
+
+func GetTTSResponse(ctx context.Context, openaiClient *openai.Client, req TTSRequest) (audio []byte, err error) {
+	ctx, span := tracing.Start(ctx, "openai.GetTTSResponse",
+		attribute.String("model", req.Model),
+		attribute.Float64("speed", req.Speed),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	request := openai.CreateSpeechRequest{
-		Model: openai.TTSModel1,
-		Input: req,
-		Voice: openai.VoiceNova,
-		Speed: speechSpeed,
+		Model: openai.SpeechModel(req.Model),
+		Input: req.Text,
+		Voice: openai.SpeechVoice(req.Voice),
+		Speed: req.Speed,
 	}
-	log.Printf("GetTTSResponse request: speed=%.1f req=%s", speechSpeed, req)
+	slog.DebugContext(ctx, "GetTTSResponse request", "speed", req.Speed, "text", logging.Redact(req.Text))
+	start := time.Now()
 	response, err := openaiClient.CreateSpeech(ctx, request)
+	metrics.TTSRequestDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
-		log.Println("error when requesting whisperapi")
+		metrics.OpenAIErrorsTotal.WithLabelValues(string(request.Model)).Inc()
+		slog.ErrorContext(ctx, "error when requesting whisperapi", "error", err)
 		return nil, err
 	}
 	defer func(io.ReadCloser) {
@@ -58,7 +134,7 @@ func GetTTSResponse(ctx context.Context, openaiClient *openai.Client, speechSpee
 
 	body, err := io.ReadAll(response)
 	if err != nil {
-		log.Println("error when reading response body")
+		slog.ErrorContext(ctx, "error when reading response body", "error", err)
 		return nil, err
 	}
 
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+type ChatSession struct {
+	Scenario     string
+	Difficulty   int
+	CleanTurns   int
+	MistakeTurns int
+}
+
+type ChatMessage struct {
+	Role    string
+	Content string
+}
+
+// StartChatSession switches the user to the scenario in the language and
+// clears the history of the previous conversation in it. The adapted
+// difficulty is kept; difficulty is only the difficulty of the first session.
+func StartChatSession(ctx context.Context, db *sql.DB, userID int, language, scenario string, difficulty int) error {
+	ctx, end := startQuery(ctx, "start_chat_session")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO chat_sessions (user_id, language, scenario, difficulty)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(user_id, language) DO UPDATE SET
+		scenario = EXCLUDED.scenario,
+		clean_turns = 0,
+		mistake_turns = 0
+	`
+	if _, err := tx.ExecContext(ctx, query, userID, language, scenario, difficulty); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM chat_messages WHERE user_id = ? AND language = ?`, userID, language); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetChatSession returns the chat session of the user in the language, or
+// nil if the user has not started one in it
+func GetChatSession(ctx context.Context, db *sql.DB, userID int, language string) (*ChatSession, error) {
+	ctx, end := startQuery(ctx, "get_chat_session")
+	defer end()
+
+	query := `
+	SELECT scenario, difficulty, clean_turns, mistake_turns
+	FROM chat_sessions
+	WHERE user_id = ? AND language = ?;
+	`
+	var session ChatSession
+	err := db.QueryRowContext(ctx, query, userID, language).Scan(&session.Scenario, &session.Difficulty, &session.CleanTurns, &session.MistakeTurns)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func UpdateChatSession(ctx context.Context, db *sql.DB, userID int, language string, session *ChatSession) error {
+	ctx, end := startQuery(ctx, "update_chat_session")
+	defer end()
+
+	query := `
+	UPDATE chat_sessions SET difficulty = ?, clean_turns = ?, mistake_turns = ?
+	WHERE user_id = ? AND language = ?;
+	`
+	_, err := db.ExecContext(ctx, query, session.Difficulty, session.CleanTurns, session.MistakeTurns, userID, language)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func StoreChatMessage(ctx context.Context, db *sql.DB, userID int, language, role, content string) error {
+	ctx, end := startQuery(ctx, "store_chat_message")
+	defer end()
+
+	query := `
+	INSERT INTO chat_messages (user_id, language, role, content)
+	VALUES (?, ?, ?, ?);
+	`
+	_, err := db.ExecContext(ctx, query, userID, language, role, content)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetChatHistory returns the last limit messages of the user's conversation
+// in the language, oldest first
+func GetChatHistory(ctx context.Context, db *sql.DB, userID int, language string, limit int) ([]ChatMessage, error) {
+	ctx, end := startQuery(ctx, "get_chat_history")
+	defer end()
+
+	query := `
+	SELECT role, content FROM (
+		SELECT id, role, content
+		FROM chat_messages
+		WHERE user_id = ? AND language = ?
+		ORDER BY id DESC
+		LIMIT ?
+	) ORDER BY id ASC;
+	`
+	rows, err := db.QueryContext(ctx, query, userID, language, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []ChatMessage
+	for rows.Next() {
+		var message ChatMessage
+		if err := rows.Scan(&message.Role, &message.Content); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
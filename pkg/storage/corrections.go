@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+type CorrectionItem struct {
+	Category    string
+	Original    string
+	Corrected   string
+	Explanation string
+}
+
+// StoreCorrection stores a corrected text with its mistakes, also recording
+// them in the mistakes table, and returns its ID
+func StoreCorrection(ctx context.Context, db *sql.DB, userID int, language, originalText, correctedText string, items []CorrectionItem) (int, error) {
+	ctx, end := startQuery(ctx, "store_correction")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO corrections (user_id, language, original_text, corrected_text)
+	VALUES (?, ?, ?, ?)
+	RETURNING id;
+	`
+	var correctionID int
+	err = tx.QueryRowContext(ctx, query, userID, language, originalText, correctedText).Scan(&correctionID)
+	if err != nil {
+		return 0, err
+	}
+
+	itemQuery := `
+	INSERT INTO correction_items (correction_id, category, original, corrected, explanation)
+	VALUES (?, ?, ?, ?, ?)
+	RETURNING id;
+	`
+	for _, item := range items {
+		var itemID int
+		err := tx.QueryRowContext(ctx, itemQuery, correctionID, item.Category, item.Original, item.Corrected, item.Explanation).Scan(&itemID)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(ctx, insertMistakeQuery, userID, language, "correct", itemID, item.Category, item.Original, item.Corrected)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return correctionID, tx.Commit()
+}
@@ -1,99 +1,163 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"time"
+
+	"language-learning-bot/pkg/metrics"
+	"language-learning-bot/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// startQuery starts a span and a latency observation for the named query,
+// returning a function that ends both
+func startQuery(ctx context.Context, name string) (context.Context, func()) {
+	ctx, span := tracing.Start(ctx, "storage."+name, attribute.String("db.system", "sqlite"))
+	observe := metrics.ObserveDBQuery(name)
+	return ctx, func() {
+		observe()
+		span.End()
+	}
+}
+
 type LastUserQuery struct {
 	Word     string
 	Type     string
 	Language string
 }
 
-func UpdateUserLanguage(db *sql.DB, userID int, language string) error {
+// UpdateUserLanguage makes the language the active language of the user,
+// adding it to the user's languages if it is new
+func UpdateUserLanguage(ctx context.Context, db *sql.DB, userID int, language string) error {
+	ctx, end := startQuery(ctx, "update_user_language")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	// SQL query for upsert operation
 	query := `
 	INSERT INTO users (id, language, help_type, speech_speed)
 	VALUES (?, ?, ?, ?)
 	ON CONFLICT(id) DO UPDATE SET
-		language = EXCLUDED.language,
-		speech_speed = CASE WHEN EXCLUDED.speech_speed > 0 THEN EXCLUDED.speech_speed ELSE users.speech_speed END
+		language = EXCLUDED.language
 	`
-	_, err := db.Exec(query, userID, language, "", 0.0)
-	if err != nil {
+	if _, err := tx.ExecContext(ctx, query, userID, language, "", 0.0); err != nil {
 		return err
 	}
-	return nil
+	query = `
+	INSERT INTO user_languages (user_id, language)
+	VALUES (?, ?)
+	ON CONFLICT(user_id, language) DO NOTHING;
+	`
+	if _, err := tx.ExecContext(ctx, query, userID, language); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func UpdateUserSpeechSpeed(db *sql.DB, userID int, speech_speed float64) error {
+// UpdateUserSpeechSpeed sets the speech speed of the user's active language
+func UpdateUserSpeechSpeed(ctx context.Context, db *sql.DB, userID int, speech_speed float64) error {
+	ctx, end := startQuery(ctx, "update_user_speech_speed")
+	defer end()
+
 	query := `
-	UPDATE users SET speech_speed = ?
-	WHERE id = ?;
+	UPDATE user_languages SET speech_speed = ?1
+	WHERE user_id = ?2 AND language = (SELECT language FROM users WHERE id = ?2);
 	`
-	_, err := db.Exec(query, speech_speed, userID)
+	_, err := db.ExecContext(ctx, query, speech_speed, userID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func GetUserLanguage(db *sql.DB, userID int) (string, error) {
+func GetUserLanguage(ctx context.Context, db *sql.DB, userID int) (string, error) {
+	ctx, end := startQuery(ctx, "get_user_language")
+	defer end()
+
 	query := `
 	SELECT language FROM users WHERE id = ?;
 	`
 	var language string
-	err := db.QueryRow(query, userID).Scan(&language)
+	err := db.QueryRowContext(ctx, query, userID).Scan(&language)
 	if err != nil {
 		return "", err
 	}
 	return language, nil
 }
 
-func GetUserSpeechSpeed(db *sql.DB, userID int) (float64, error) {
+// GetUserSpeechSpeed returns the speech speed of the user's active language
+func GetUserSpeechSpeed(ctx context.Context, db *sql.DB, userID int) (float64, error) {
+	ctx, end := startQuery(ctx, "get_user_speech_speed")
+	defer end()
+
 	query := `
-	SELECT speech_speed FROM users WHERE id = ?;
+	SELECT ul.speech_speed
+	FROM users u
+	JOIN user_languages ul ON ul.user_id = u.id AND ul.language = u.language
+	WHERE u.id = ?;
 	`
 	var speechSpeed float64
-	err := db.QueryRow(query, userID).Scan(&speechSpeed)
+	err := db.QueryRowContext(ctx, query, userID).Scan(&speechSpeed)
 	if err != nil {
 		return 1.0, err
 	}
 	return speechSpeed, nil
 }
 
-func UpdateUserHelpType(db *sql.DB, userID int, helpType string) error {
+// UpdateUserHelpType sets the help type of the user's active language
+func UpdateUserHelpType(ctx context.Context, db *sql.DB, userID int, helpType string) error {
+	ctx, end := startQuery(ctx, "update_user_help_type")
+	defer end()
+
 	query := `
-    UPDATE users SET help_type = ?
-    WHERE id = ?;
+    UPDATE user_languages SET help_type = ?1
+    WHERE user_id = ?2 AND language = (SELECT language FROM users WHERE id = ?2);
     `
-	_, err := db.Exec(query, helpType, userID)
+	_, err := db.ExecContext(ctx, query, helpType, userID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func GetUserHelpType(db *sql.DB, userID int) (string, error) {
+// GetUserHelpType returns the help type of the user's active language
+func GetUserHelpType(ctx context.Context, db *sql.DB, userID int) (string, error) {
+	ctx, end := startQuery(ctx, "get_user_help_type")
+	defer end()
+
 	query := `
-	SELECT help_type FROM users WHERE id = ?;
+	SELECT ul.help_type
+	FROM users u
+	JOIN user_languages ul ON ul.user_id = u.id AND ul.language = u.language
+	WHERE u.id = ?;
 	`
 	var helpType string
-	err := db.QueryRow(query, userID).Scan(&helpType)
+	err := db.QueryRowContext(ctx, query, userID).Scan(&helpType)
 	if err != nil {
 		return "", err
 	}
 	return helpType, nil
 }
 
-func StoreQuery(db *sql.DB, userID int, helpType, language, word string) (int, error) {
+func StoreQuery(ctx context.Context, db *sql.DB, userID int, helpType, language, word string) (int, error) {
+	ctx, end := startQuery(ctx, "store_query")
+	defer end()
+
 	query := `
 	INSERT INTO queries (user_id, help_type, language, word)
 	VALUES (?, ?, ?, ?)
 	RETURNING id;
 	`
 	var queryID int
-	err := db.QueryRow(query, userID, helpType, language, word).Scan(&queryID)
+	err := db.QueryRowContext(ctx, query, userID, helpType, language, word).Scan(&queryID)
 	if err != nil {
 		return 0, err
 	}
@@ -101,8 +165,11 @@ func StoreQuery(db *sql.DB, userID int, helpType, language, word string) (int, e
 	return queryID, nil
 }
 
-func GetLastUserQuery(db *sql.DB, userID int) (*LastUserQuery, error) {
-	// select last query from user, join with cached_responses to get type
+func GetLastUserQuery(ctx context.Context, db *sql.DB, userID int) (*LastUserQuery, error) {
+	ctx, end := startQuery(ctx, "get_last_user_query")
+	defer end()
+
+	// select last query from user, join with response_cache to get type
 	query := `
   SELECT q.word, q.help_type, q.language
   FROM queries q
@@ -111,7 +178,7 @@ func GetLastUserQuery(db *sql.DB, userID int) (*LastUserQuery, error) {
   LIMIT 1;
   `
 	var lastQuery LastUserQuery
-	qr := db.QueryRow(query, userID)
+	qr := db.QueryRowContext(ctx, query, userID)
 	if qr.Err() != nil {
 		return nil, qr.Err()
 	}
@@ -119,43 +186,127 @@ func GetLastUserQuery(db *sql.DB, userID int) (*LastUserQuery, error) {
 	return &lastQuery, nil
 }
 
-func CacheResponse(db *sql.DB, query_id int, response string) error {
+func CacheResponse(ctx context.Context, db *sql.DB, query_id int, response string) error {
+	ctx, end := startQuery(ctx, "cache_response")
+	defer end()
+
 	query := `
-  INSERT INTO cached_responses (query_id, response)
+  INSERT INTO response_cache (query_id, response)
   VALUES (?, ?);
   `
-	_, err := db.Exec(query, query_id, response)
+	_, err := db.ExecContext(ctx, query, query_id, response)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func GetCachedResponseByWordLangAndType(db *sql.DB, language, helpType, word string) (string, error) {
+// GetCachedResponseByWordLangAndType returns the cached response for the word
+// written for the CEFR level, an empty level for responses written for any
+func GetCachedResponseByWordLangAndType(ctx context.Context, db *sql.DB, language, helpType, word, level string) (string, error) {
+	ctx, end := startQuery(ctx, "get_cached_response")
+	defer end()
+
 	query := `
   SELECT cr.response
-  FROM cached_responses cr
+  FROM response_cache cr
   JOIN queries q ON q.id = cr.query_id
-  WHERE q.language = ? AND q.help_type = ? AND q.word = ? ;
+  LEFT JOIN cached_response_levels l ON l.query_id = cr.query_id
+  WHERE q.language = ? AND q.help_type = ? AND q.word = ? AND COALESCE(l.level, '') = ?
+  ORDER BY q.id DESC
+  LIMIT 1;
   `
 	var response string
-	qr := db.QueryRow(query, language, helpType, word)
-	err := qr.Err()
+	err := db.QueryRowContext(ctx, query, language, helpType, word, level).Scan(&response)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
 	if err != nil {
 		return "", err
 	}
-	qr.Scan(&response)
 	return response, nil
 }
 
-func CleanOldCachedResponses(db *sql.DB) error {
+// CacheResponseLevel stores the CEFR level a cached response was written for
+func CacheResponseLevel(ctx context.Context, db *sql.DB, queryID int, level string) error {
+	ctx, end := startQuery(ctx, "cache_response_level")
+	defer end()
+
 	query := `
-        DELETE FROM cached_responses
-        WHERE datetime(created_at) < datetime('now', '-24 hours');
-    `
-	_, err := db.Exec(query)
+  INSERT INTO cached_response_levels (query_id, level)
+  VALUES (?, ?);
+  `
+	_, err := db.ExecContext(ctx, query, queryID, level)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// CacheStructuredResponse stores the structured answer a cached response was rendered from
+func CacheStructuredResponse(ctx context.Context, db *sql.DB, queryID int, structured string) error {
+	ctx, end := startQuery(ctx, "cache_structured_response")
+	defer end()
+
+	query := `
+  INSERT INTO structured_responses (query_id, structured)
+  VALUES (?, ?);
+  `
+	_, err := db.ExecContext(ctx, query, queryID, structured)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetCachedStructuredResponse returns the structured answer for the word
+// written for the CEFR level, or an empty string if the response was cached
+// before answers were structured
+func GetCachedStructuredResponse(ctx context.Context, db *sql.DB, language, helpType, word, level string) (string, error) {
+	ctx, end := startQuery(ctx, "get_cached_structured_response")
+	defer end()
+
+	query := `
+  SELECT sr.structured
+  FROM structured_responses sr
+  JOIN queries q ON q.id = sr.query_id
+  LEFT JOIN cached_response_levels l ON l.query_id = sr.query_id
+  WHERE q.language = ? AND q.help_type = ? AND q.word = ? AND COALESCE(l.level, '') = ?
+  ORDER BY q.id DESC
+  LIMIT 1;
+  `
+	var structured string
+	err := db.QueryRowContext(ctx, query, language, helpType, word, level).Scan(&structured)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return structured, nil
+}
+
+// CleanOldCachedResponses removes cached responses older than ttl with their
+// structured answers and levels
+func CleanOldCachedResponses(ctx context.Context, db *sql.DB, ttl time.Duration) error {
+	ctx, end := startQuery(ctx, "clean_old_cached_responses")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	expired := `SELECT query_id FROM response_cache WHERE datetime(created_at) < datetime('now', ?1)`
+	for _, query := range []string{
+		`DELETE FROM structured_responses WHERE query_id IN (` + expired + `);`,
+		`DELETE FROM cached_response_levels WHERE query_id IN (` + expired + `);`,
+		`DELETE FROM response_cache WHERE query_id IN (` + expired + `);`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, fmt.Sprintf("-%d seconds", int(ttl.Seconds()))); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
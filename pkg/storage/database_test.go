@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	languagelearningbot "language-learning-bot"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openTestDatabase returns an in-memory database with the schema applied
+func openTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection to :memory: is a database of its own
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(languagelearningbot.InitDBSQL); err != nil {
+		t.Fatalf("applying the schema: %v", err)
+	}
+	return db
+}
+
+func countRows(t *testing.T, db *sql.DB, table string) int {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestCleanOldCachedResponses(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDatabase(t)
+
+	cache := func(word, createdAt string) {
+		t.Helper()
+		queryID, err := StoreQuery(ctx, db, 1, "examples", "Dutch", word)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO response_cache (query_id, response, created_at) VALUES (?, ?, ?)`, queryID, "response", createdAt); err != nil {
+			t.Fatal(err)
+		}
+		if err := CacheStructuredResponse(ctx, db, queryID, "{}"); err != nil {
+			t.Fatal(err)
+		}
+		if err := CacheResponseLevel(ctx, db, queryID, "A2"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().UTC()
+	cache("huis", now.Add(-48*time.Hour).Format(time.DateTime))
+	cache("boom", now.Add(-time.Hour).Format(time.DateTime))
+
+	if err := CleanOldCachedResponses(ctx, db, 24*time.Hour); err != nil {
+		t.Fatalf("CleanOldCachedResponses: %v", err)
+	}
+
+	for _, table := range []string{"response_cache", "structured_responses", "cached_response_levels"} {
+		if got := countRows(t, db, table); got != 1 {
+			t.Errorf("%s has %d rows, want 1", table, got)
+		}
+	}
+	for word, want := range map[string]string{"huis": "", "boom": "response"} {
+		got, err := GetCachedResponseByWordLangAndType(ctx, db, "Dutch", "examples", word, "A2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("cached response of %s = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestResponseCacheMigration(t *testing.T) {
+	db := openTestDatabase(t)
+
+	// a cache from before responses recorded when they were cached
+	_, err := db.Exec(`
+	CREATE TABLE cached_responses (query_id INTEGER NOT NULL, response TEXT NOT NULL);
+	INSERT INTO queries (id, user_id, word, language, help_type, timestamp) VALUES (7, 1, 'huis', 'Dutch', 'examples', '2024-01-02 03:04:05');
+	INSERT INTO cached_responses (query_id, response) VALUES (7, 'house');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := db.Exec(languagelearningbot.InitDBSQL); err != nil {
+			t.Fatalf("applying the schema again: %v", err)
+		}
+	}
+
+	var response, createdAt string
+	err = db.QueryRow(`SELECT response, created_at FROM response_cache WHERE query_id = 7`).Scan(&response, &createdAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != "house" || createdAt != "2024-01-02T03:04:05Z" {
+		t.Errorf("migrated row = %q cached at %q, want %q cached at the time of the lookup", response, createdAt, "house")
+	}
+	if got := countRows(t, db, "response_cache"); got != 1 {
+		t.Errorf("response_cache has %d rows, want 1", got)
+	}
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+type Exercise struct {
+	ID       int
+	UserID   int
+	Language string
+	Kind     string
+	Word     string
+	Prompt   string
+	Answer   string
+	Context  string
+}
+
+// CreateExercise stores an exercise sent to the user and returns its ID
+func CreateExercise(ctx context.Context, db *sql.DB, exercise Exercise) (int, error) {
+	ctx, end := startQuery(ctx, "create_exercise")
+	defer end()
+
+	query := `
+	INSERT INTO exercises (user_id, language, kind, word, prompt, answer, context)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	RETURNING id;
+	`
+	var exerciseID int
+	err := db.QueryRowContext(ctx, query, exercise.UserID, exercise.Language, exercise.Kind, exercise.Word,
+		exercise.Prompt, exercise.Answer, exercise.Context).Scan(&exerciseID)
+	if err != nil {
+		return 0, err
+	}
+	return exerciseID, nil
+}
+
+// GetPendingExercise returns the last unanswered exercise of the kind sent to
+// the user in the language, or nil if there is none
+func GetPendingExercise(ctx context.Context, db *sql.DB, userID int, language, kind string) (*Exercise, error) {
+	ctx, end := startQuery(ctx, "get_pending_exercise")
+	defer end()
+
+	query := `
+	SELECT id, user_id, language, kind, word, prompt, answer, context
+	FROM exercises
+	WHERE user_id = ? AND language = ? AND kind = ? AND answered_at IS NULL
+	ORDER BY id DESC
+	LIMIT 1;
+	`
+	var exercise Exercise
+	err := db.QueryRowContext(ctx, query, userID, language, kind).Scan(&exercise.ID, &exercise.UserID, &exercise.Language,
+		&exercise.Kind, &exercise.Word, &exercise.Prompt, &exercise.Answer, &exercise.Context)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &exercise, nil
+}
+
+// AnswerExercise stores the user's answer to the exercise and its score
+func AnswerExercise(ctx context.Context, db *sql.DB, exerciseID int, userAnswer string, score float64) error {
+	ctx, end := startQuery(ctx, "answer_exercise")
+	defer end()
+
+	query := `
+	UPDATE exercises SET user_answer = ?, score = ?, answered_at = CURRENT_TIMESTAMP
+	WHERE id = ?;
+	`
+	_, err := db.ExecContext(ctx, query, userAnswer, score, exerciseID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
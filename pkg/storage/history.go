@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// HistoryEntry is a word or phrase the user looked up
+type HistoryEntry struct {
+	Language  string
+	HelpType  string
+	Word      string
+	Timestamp time.Time
+}
+
+// ReviewStats sums up the answers of the user to the exercises of an
+// activity, such as drills or quizzes, in a language
+type ReviewStats struct {
+	Language string
+	Activity string
+	Answered int
+	// Score is the sum of the scores of the answers, from 0 for wrong to 1
+	// for correct each
+	Score float64
+}
+
+// GetQueryHistory returns every lookup of the user, oldest first
+func GetQueryHistory(ctx context.Context, db *sql.DB, userID int) ([]HistoryEntry, error) {
+	ctx, end := startQuery(ctx, "get_query_history")
+	defer end()
+
+	query := `
+	SELECT language, help_type, word, timestamp
+	FROM queries
+	WHERE user_id = ?
+	ORDER BY timestamp, id;
+	`
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []HistoryEntry
+	for rows.Next() {
+		var entry HistoryEntry
+		if err := rows.Scan(&entry.Language, &entry.HelpType, &entry.Word, &entry.Timestamp); err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+	return history, rows.Err()
+}
+
+// GetReviewStats returns the answered exercises and quiz questions of the
+// user per language and activity
+func GetReviewStats(ctx context.Context, db *sql.DB, userID int) ([]ReviewStats, error) {
+	ctx, end := startQuery(ctx, "get_review_stats")
+	defer end()
+
+	query := `
+	SELECT language, kind, COUNT(*), COALESCE(SUM(score), 0)
+	FROM exercises
+	WHERE user_id = ?1 AND answered_at IS NOT NULL
+	GROUP BY language, kind
+	UNION ALL
+	SELECT z.language, 'quiz', COUNT(*), COALESCE(SUM(qq.chosen_option = qq.correct_option), 0)
+	FROM quiz_questions qq
+	JOIN quizzes z ON z.id = qq.quiz_id
+	WHERE z.user_id = ?1 AND qq.answered_at IS NOT NULL
+	GROUP BY z.language
+	ORDER BY 1, 2;
+	`
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []ReviewStats
+	for rows.Next() {
+		var s ReviewStats
+		if err := rows.Scan(&s.Language, &s.Activity, &s.Answered, &s.Score); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+// GetUserLanguages returns the languages the user learns in the order they
+// were added
+func GetUserLanguages(ctx context.Context, db *sql.DB, userID int) ([]string, error) {
+	ctx, end := startQuery(ctx, "get_user_languages")
+	defer end()
+
+	query := `
+	SELECT language FROM user_languages
+	WHERE user_id = ?
+	ORDER BY added_at, language;
+	`
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var languages []string
+	for rows.Next() {
+		var language string
+		if err := rows.Scan(&language); err != nil {
+			return nil, err
+		}
+		languages = append(languages, language)
+	}
+	return languages, rows.Err()
+}
+
+// RemoveUserLanguage removes the language from the user's languages unless
+// it is the active one, and reports whether it was removed. The history,
+// words and level of the language are kept for when it is added again.
+func RemoveUserLanguage(ctx context.Context, db *sql.DB, userID int, language string) (bool, error) {
+	ctx, end := startQuery(ctx, "remove_user_language")
+	defer end()
+
+	query := `
+	DELETE FROM user_languages
+	WHERE user_id = ?1 AND language = ?2 AND language != (SELECT language FROM users WHERE id = ?1);
+	`
+	result, err := db.ExecContext(ctx, query, userID, language)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return removed > 0, nil
+}
+
+// UpdateUserLanguageHelpType sets the help type of one of the user's languages
+func UpdateUserLanguageHelpType(ctx context.Context, db *sql.DB, userID int, language, helpType string) error {
+	ctx, end := startQuery(ctx, "update_user_language_help_type")
+	defer end()
+
+	query := `
+	UPDATE user_languages SET help_type = ?
+	WHERE user_id = ? AND language = ?;
+	`
+	_, err := db.ExecContext(ctx, query, helpType, userID, language)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetWordLanguages returns those of the user's languages the user looked up
+// or saved the word in before
+func GetWordLanguages(ctx context.Context, db *sql.DB, userID int, word string) ([]string, error) {
+	ctx, end := startQuery(ctx, "get_word_languages")
+	defer end()
+
+	query := `
+	SELECT ul.language
+	FROM user_languages ul
+	WHERE ul.user_id = ?1 AND (
+		EXISTS (SELECT 1 FROM queries q WHERE q.user_id = ?1 AND q.language = ul.language AND q.word = ?2 COLLATE NOCASE)
+		OR EXISTS (SELECT 1 FROM vocabulary v WHERE v.user_id = ?1 AND v.language = ul.language AND v.word = ?2)
+	)
+	ORDER BY ul.added_at, ul.language;
+	`
+	rows, err := db.QueryContext(ctx, query, userID, word)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var languages []string
+	for rows.Next() {
+		var language string
+		if err := rows.Scan(&language); err != nil {
+			return nil, err
+		}
+		languages = append(languages, language)
+	}
+	return languages, rows.Err()
+}
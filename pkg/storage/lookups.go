@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+// StructuredLookup is a word the user looked up with its structured answer
+type StructuredLookup struct {
+	Word       string
+	HelpType   string
+	Structured string
+}
+
+// GetStructuredLookups returns the distinct words the user looked up in the
+// language that have a structured answer, most recent first
+func GetStructuredLookups(ctx context.Context, db *sql.DB, userID int, language string) ([]StructuredLookup, error) {
+	ctx, end := startQuery(ctx, "get_structured_lookups")
+	defer end()
+
+	query := `
+	SELECT q.word, q.help_type, MAX(sr.structured)
+	FROM queries q
+	JOIN queries answered ON answered.language = q.language AND answered.help_type = q.help_type AND answered.word = q.word
+	JOIN structured_responses sr ON sr.query_id = answered.id
+	WHERE q.user_id = ? AND q.language = ?
+	GROUP BY q.word, q.help_type
+	ORDER BY MAX(q.timestamp) DESC;
+	`
+	rows, err := db.QueryContext(ctx, query, userID, language)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lookups []StructuredLookup
+	for rows.Next() {
+		var lookup StructuredLookup
+		if err := rows.Scan(&lookup.Word, &lookup.HelpType, &lookup.Structured); err != nil {
+			return nil, err
+		}
+		lookups = append(lookups, lookup)
+	}
+	return lookups, rows.Err()
+}
+
+// LookupResponse is a word the user looked up with its cached response and,
+// if it was answered after responses became structured, its structured answer
+type LookupResponse struct {
+	Word       string
+	Response   string
+	Structured string
+}
+
+// GetLookupResponses returns the distinct words the user looked up in the
+// language with the help type that have a cached response, most recent first
+func GetLookupResponses(ctx context.Context, db *sql.DB, userID int, language, helpType string) ([]LookupResponse, error) {
+	ctx, end := startQuery(ctx, "get_lookup_responses")
+	defer end()
+
+	query := `
+	SELECT q.word, MAX(cr.response), COALESCE(MAX(sr.structured), '')
+	FROM queries q
+	JOIN queries answered ON answered.language = q.language AND answered.help_type = q.help_type AND answered.word = q.word
+	JOIN response_cache cr ON cr.query_id = answered.id
+	LEFT JOIN structured_responses sr ON sr.query_id = answered.id
+	WHERE q.user_id = ? AND q.language = ? AND q.help_type = ?
+	GROUP BY q.word
+	ORDER BY MAX(q.timestamp) DESC;
+	`
+	rows, err := db.QueryContext(ctx, query, userID, language, helpType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lookups []LookupResponse
+	for rows.Next() {
+		var lookup LookupResponse
+		if err := rows.Scan(&lookup.Word, &lookup.Response, &lookup.Structured); err != nil {
+			return nil, err
+		}
+		lookups = append(lookups, lookup)
+	}
+	return lookups, rows.Err()
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+// recentMistakesWindow is the period CategoryStats.Recent counts mistakes in
+const recentMistakesWindow = "-30 days"
+
+const insertMistakeQuery = `
+	INSERT INTO mistakes (user_id, language, source, source_id, category, original, corrected)
+	VALUES (?, ?, ?, ?, ?, ?, ?);
+	`
+
+type Mistake struct {
+	Category  string
+	Original  string
+	Corrected string
+}
+
+// CategoryStats counts the mistakes of a user in a category
+type CategoryStats struct {
+	Category string
+	Total    int
+	// Recent is the number of mistakes in the last 30 days
+	Recent int
+	// Previous is the number of mistakes in the 30 days before that
+	Previous int
+}
+
+// RecordMistakes stores the mistakes a user made in the source mode, e.g. chat
+func RecordMistakes(ctx context.Context, db *sql.DB, userID int, language, source string, mistakes []Mistake) error {
+	ctx, end := startQuery(ctx, "record_mistakes")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, mistake := range mistakes {
+		_, err := tx.ExecContext(ctx, insertMistakeQuery, userID, language, source, nil, mistake.Category, mistake.Original, mistake.Corrected)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetMistakeCategoryStats returns the mistake counts of the user in the
+// language per category, most frequent recently first
+func GetMistakeCategoryStats(ctx context.Context, db *sql.DB, userID int, language string) ([]CategoryStats, error) {
+	ctx, end := startQuery(ctx, "get_mistake_category_stats")
+	defer end()
+
+	query := `
+	SELECT category,
+		COUNT(*),
+		SUM(CASE WHEN timestamp >= datetime('now', ?1) THEN 1 ELSE 0 END),
+		SUM(CASE WHEN timestamp < datetime('now', ?1) AND timestamp >= datetime('now', ?1, ?1) THEN 1 ELSE 0 END)
+	FROM mistakes
+	WHERE user_id = ?2 AND language = ?3
+	GROUP BY category
+	ORDER BY 3 DESC, 2 DESC, category;
+	`
+	rows, err := db.QueryContext(ctx, query, recentMistakesWindow, userID, language)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []CategoryStats
+	for rows.Next() {
+		var s CategoryStats
+		if err := rows.Scan(&s.Category, &s.Total, &s.Recent, &s.Previous); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// GetRecentMistakes returns the last mistakes of the user in the language
+// and category, newest first
+func GetRecentMistakes(ctx context.Context, db *sql.DB, userID int, language, category string, limit int) ([]Mistake, error) {
+	ctx, end := startQuery(ctx, "get_recent_mistakes")
+	defer end()
+
+	query := `
+	SELECT category, original, corrected
+	FROM mistakes
+	WHERE user_id = ? AND language = ? AND category = ?
+	ORDER BY id DESC
+	LIMIT ?;
+	`
+	rows, err := db.QueryContext(ctx, query, userID, language, category, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mistakes []Mistake
+	for rows.Next() {
+		var m Mistake
+		if err := rows.Scan(&m.Category, &m.Original, &m.Corrected); err != nil {
+			return nil, err
+		}
+		mistakes = append(mistakes, m)
+	}
+	return mistakes, rows.Err()
+}
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+type PlacementTest struct {
+	ID       int
+	UserID   int
+	Language string
+	// PreviousHelpType is the mode the user was in before the test
+	PreviousHelpType string
+}
+
+type PlacementQuestion struct {
+	ID       int
+	TestID   int
+	Position int
+	// Level is the CEFR level the question was written for
+	Level    string
+	Question string
+	// Options are the answer options of a multiple-choice question, empty for
+	// a short answer question
+	Options      []string
+	Answer       string
+	Alternatives []string
+	Explanation  string
+	Answered     bool
+	Correct      bool
+}
+
+// GetUserLevel returns the CEFR level of the user in the language, or an
+// empty string if it is not known
+func GetUserLevel(ctx context.Context, db *sql.DB, userID int, language string) (string, error) {
+	ctx, end := startQuery(ctx, "get_user_level")
+	defer end()
+
+	var level string
+	err := db.QueryRowContext(ctx, `SELECT level FROM user_levels WHERE user_id = ? AND language = ?;`, userID, language).Scan(&level)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return level, nil
+}
+
+// SetUserLevel stores the CEFR level of the user in the language
+func SetUserLevel(ctx context.Context, db *sql.DB, userID int, language, level string) error {
+	ctx, end := startQuery(ctx, "set_user_level")
+	defer end()
+
+	query := `
+	INSERT INTO user_levels (user_id, language, level)
+	VALUES (?, ?, ?)
+	ON CONFLICT(user_id, language) DO UPDATE SET
+		level = EXCLUDED.level,
+		updated_at = CURRENT_TIMESTAMP;
+	`
+	_, err := db.ExecContext(ctx, query, userID, language, level)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// StartPlacementTest stores a new placement test of the user and returns its ID
+func StartPlacementTest(ctx context.Context, db *sql.DB, userID int, language, previousHelpType string) (int, error) {
+	ctx, end := startQuery(ctx, "start_placement_test")
+	defer end()
+
+	query := `
+	INSERT INTO placement_tests (user_id, language, previous_help_type)
+	VALUES (?, ?, ?)
+	RETURNING id;
+	`
+	var testID int
+	err := db.QueryRowContext(ctx, query, userID, language, previousHelpType).Scan(&testID)
+	if err != nil {
+		return 0, err
+	}
+	return testID, nil
+}
+
+// GetActivePlacementTest returns the last unfinished placement test of the
+// user, or nil if there is none
+func GetActivePlacementTest(ctx context.Context, db *sql.DB, userID int) (*PlacementTest, error) {
+	ctx, end := startQuery(ctx, "get_active_placement_test")
+	defer end()
+
+	query := `
+	SELECT id, user_id, language, previous_help_type
+	FROM placement_tests
+	WHERE user_id = ? AND finished_at IS NULL
+	ORDER BY id DESC
+	LIMIT 1;
+	`
+	var test PlacementTest
+	err := db.QueryRowContext(ctx, query, userID).Scan(&test.ID, &test.UserID, &test.Language, &test.PreviousHelpType)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &test, nil
+}
+
+// AddPlacementQuestion stores the next question of the test, setting its ID
+// and position
+func AddPlacementQuestion(ctx context.Context, db *sql.DB, question *PlacementQuestion) error {
+	ctx, end := startQuery(ctx, "add_placement_question")
+	defer end()
+
+	options, err := json.Marshal(question.Options)
+	if err != nil {
+		return err
+	}
+	alternatives, err := json.Marshal(question.Alternatives)
+	if err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO placement_questions (test_id, position, level, question, options, answer, alternatives, explanation)
+	VALUES (?1, (SELECT COUNT(*) FROM placement_questions WHERE test_id = ?1), ?2, ?3, ?4, ?5, ?6, ?7)
+	RETURNING id, position;
+	`
+	return db.QueryRowContext(ctx, query, question.TestID, question.Level, question.Question, string(options),
+		question.Answer, string(alternatives), question.Explanation).Scan(&question.ID, &question.Position)
+}
+
+const placementQuestionColumns = `id, test_id, position, level, question, options, answer, alternatives, explanation,
+	answered_at IS NOT NULL, COALESCE(correct, 0)`
+
+func scanPlacementQuestion(scan func(dest ...any) error) (*PlacementQuestion, error) {
+	var question PlacementQuestion
+	var options, alternatives string
+	err := scan(&question.ID, &question.TestID, &question.Position, &question.Level, &question.Question, &options,
+		&question.Answer, &alternatives, &question.Explanation, &question.Answered, &question.Correct)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(options), &question.Options); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(alternatives), &question.Alternatives); err != nil {
+		return nil, err
+	}
+	return &question, nil
+}
+
+// GetPlacementQuestion returns the question of the user's placement test with
+// the ID, or nil if there is none
+func GetPlacementQuestion(ctx context.Context, db *sql.DB, userID int, questionID int) (*PlacementQuestion, error) {
+	ctx, end := startQuery(ctx, "get_placement_question")
+	defer end()
+
+	query := `
+	SELECT ` + placementQuestionColumns + `
+	FROM placement_questions
+	WHERE id = ? AND test_id IN (SELECT id FROM placement_tests WHERE user_id = ?);
+	`
+	question, err := scanPlacementQuestion(db.QueryRowContext(ctx, query, questionID, userID).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return question, err
+}
+
+// GetPlacementQuestions returns the questions of the test in the order they
+// were asked
+func GetPlacementQuestions(ctx context.Context, db *sql.DB, testID int) ([]PlacementQuestion, error) {
+	ctx, end := startQuery(ctx, "get_placement_questions")
+	defer end()
+
+	query := `
+	SELECT ` + placementQuestionColumns + `
+	FROM placement_questions
+	WHERE test_id = ?
+	ORDER BY position;
+	`
+	rows, err := db.QueryContext(ctx, query, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []PlacementQuestion
+	for rows.Next() {
+		question, err := scanPlacementQuestion(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, *question)
+	}
+	return questions, rows.Err()
+}
+
+// AnswerPlacementQuestion records the user's answer and reports whether the
+// question was still unanswered
+func AnswerPlacementQuestion(ctx context.Context, db *sql.DB, questionID int, userAnswer string, correct bool) (bool, error) {
+	ctx, end := startQuery(ctx, "answer_placement_question")
+	defer end()
+
+	query := `
+	UPDATE placement_questions SET user_answer = ?, correct = ?, answered_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND answered_at IS NULL;
+	`
+	result, err := db.ExecContext(ctx, query, userAnswer, correct, questionID)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return updated > 0, nil
+}
+
+// FinishPlacementTest stores the level the test placed the user at, as the
+// level of the test and of the user in the language of the test
+func FinishPlacementTest(ctx context.Context, db *sql.DB, test *PlacementTest, level string) error {
+	ctx, end := startQuery(ctx, "finish_placement_test")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE placement_tests SET level = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ?;`, level, test.ID)
+	if err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO user_levels (user_id, language, level)
+	VALUES (?, ?, ?)
+	ON CONFLICT(user_id, language) DO UPDATE SET
+		level = EXCLUDED.level,
+		updated_at = CURRENT_TIMESTAMP;
+	`
+	if _, err := tx.ExecContext(ctx, query, test.UserID, test.Language, level); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
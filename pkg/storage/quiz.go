@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+type QuizQuestion struct {
+	ID     int
+	QuizID int
+	// Language is the language of the quiz
+	Language string
+	Position int
+	// Total is the number of questions of the quiz
+	Total     int
+	Word      string
+	Direction string
+	Prompt    string
+	Options   []string
+	Correct   int
+	// Chosen is the option picked by the user, or -1 if not answered yet
+	Chosen int
+}
+
+// QuizScore is the result of a finished quiz
+type QuizScore struct {
+	Score int
+	Total int
+}
+
+// CreateQuiz stores a quiz with its questions, setting their IDs
+func CreateQuiz(ctx context.Context, db *sql.DB, userID int, language string, questions []QuizQuestion) (int, error) {
+	ctx, end := startQuery(ctx, "create_quiz")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var quizID int
+	err = tx.QueryRowContext(ctx, `INSERT INTO quizzes (user_id, language) VALUES (?, ?) RETURNING id;`, userID, language).Scan(&quizID)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+	INSERT INTO quiz_questions (quiz_id, position, word, direction, prompt, options, correct_option)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	RETURNING id;
+	`
+	for i := range questions {
+		options, err := json.Marshal(questions[i].Options)
+		if err != nil {
+			return 0, err
+		}
+		questions[i].QuizID = quizID
+		questions[i].Position = i
+		questions[i].Total = len(questions)
+		questions[i].Chosen = -1
+		err = tx.QueryRowContext(ctx, query, quizID, i, questions[i].Word, questions[i].Direction, questions[i].Prompt, string(options), questions[i].Correct).Scan(&questions[i].ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return quizID, tx.Commit()
+}
+
+const quizQuestionColumns = `id, quiz_id,
+	(SELECT language FROM quizzes WHERE quizzes.id = quiz_questions.quiz_id), position,
+	(SELECT COUNT(*) FROM quiz_questions total WHERE total.quiz_id = quiz_questions.quiz_id),
+	word, direction, prompt, options, correct_option, COALESCE(chosen_option, -1)`
+
+func scanQuizQuestion(row *sql.Row) (*QuizQuestion, error) {
+	var question QuizQuestion
+	var options string
+	err := row.Scan(&question.ID, &question.QuizID, &question.Language, &question.Position, &question.Total, &question.Word, &question.Direction,
+		&question.Prompt, &options, &question.Correct, &question.Chosen)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(options), &question.Options); err != nil {
+		return nil, err
+	}
+	return &question, nil
+}
+
+// GetQuizQuestion returns the question of the user's quiz with the ID, or nil
+// if there is none
+func GetQuizQuestion(ctx context.Context, db *sql.DB, userID int, questionID int) (*QuizQuestion, error) {
+	ctx, end := startQuery(ctx, "get_quiz_question")
+	defer end()
+
+	query := `
+	SELECT ` + quizQuestionColumns + `
+	FROM quiz_questions
+	WHERE id = ? AND quiz_id IN (SELECT id FROM quizzes WHERE user_id = ?);
+	`
+	return scanQuizQuestion(db.QueryRowContext(ctx, query, questionID, userID))
+}
+
+// GetNextQuizQuestion returns the first unanswered question of the quiz, or
+// nil if every question is answered
+func GetNextQuizQuestion(ctx context.Context, db *sql.DB, quizID int) (*QuizQuestion, error) {
+	ctx, end := startQuery(ctx, "get_next_quiz_question")
+	defer end()
+
+	query := `
+	SELECT ` + quizQuestionColumns + `
+	FROM quiz_questions
+	WHERE quiz_id = ? AND chosen_option IS NULL
+	ORDER BY position
+	LIMIT 1;
+	`
+	return scanQuizQuestion(db.QueryRowContext(ctx, query, quizID))
+}
+
+// AnswerQuizQuestion records the chosen option and reports whether the
+// question was still unanswered
+func AnswerQuizQuestion(ctx context.Context, db *sql.DB, questionID int, chosen int) (bool, error) {
+	ctx, end := startQuery(ctx, "answer_quiz_question")
+	defer end()
+
+	query := `
+	UPDATE quiz_questions SET chosen_option = ?, answered_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND chosen_option IS NULL;
+	`
+	result, err := db.ExecContext(ctx, query, chosen, questionID)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return updated > 0, nil
+}
+
+// FinishQuiz stores the score of the quiz and returns it
+func FinishQuiz(ctx context.Context, db *sql.DB, quizID int) (*QuizScore, error) {
+	ctx, end := startQuery(ctx, "finish_quiz")
+	defer end()
+
+	query := `
+	UPDATE quizzes SET
+		score = (SELECT COUNT(*) FROM quiz_questions WHERE quiz_id = ?1 AND chosen_option = correct_option),
+		finished_at = CURRENT_TIMESTAMP
+	WHERE id = ?1
+	RETURNING score, (SELECT COUNT(*) FROM quiz_questions WHERE quiz_id = ?1);
+	`
+	var score QuizScore
+	err := db.QueryRowContext(ctx, query, quizID).Scan(&score.Score, &score.Total)
+	if err != nil {
+		return nil, err
+	}
+	return &score, nil
+}
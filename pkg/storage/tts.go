@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CacheTTS stores the speech generated for the text with the voice settings
+func CacheTTS(ctx context.Context, db *sql.DB, text, model, voice string, speed float64, audio []byte) error {
+	ctx, end := startQuery(ctx, "cache_tts")
+	defer end()
+
+	query := `
+	INSERT INTO tts_cache (text, model, voice, speed, audio)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(text, model, voice, speed) DO UPDATE SET audio = EXCLUDED.audio, created_at = CURRENT_TIMESTAMP;
+	`
+	_, err := db.ExecContext(ctx, query, text, model, voice, speed, audio)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetCachedTTS returns the speech generated for the text with the voice
+// settings, or nil if there is none
+func GetCachedTTS(ctx context.Context, db *sql.DB, text, model, voice string, speed float64) ([]byte, error) {
+	ctx, end := startQuery(ctx, "get_cached_tts")
+	defer end()
+
+	query := `
+	SELECT audio FROM tts_cache
+	WHERE text = ? AND model = ? AND voice = ? AND speed = ?;
+	`
+	var audio []byte
+	err := db.QueryRowContext(ctx, query, text, model, voice, speed).Scan(&audio)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return audio, nil
+}
+
+// CleanOldCachedTTS removes speech generated longer than ttl ago, except
+// that of saved words, which the Anki export takes the pronunciation from
+func CleanOldCachedTTS(ctx context.Context, db *sql.DB, ttl time.Duration) error {
+	ctx, end := startQuery(ctx, "clean_old_cached_tts")
+	defer end()
+
+	query := `
+	DELETE FROM tts_cache
+	WHERE datetime(created_at) < datetime('now', ?1)
+	AND text NOT IN (SELECT word FROM vocabulary);
+	`
+	_, err := db.ExecContext(ctx, query, fmt.Sprintf("-%d seconds", int(ttl.Seconds())))
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCleanOldCachedTTS(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDatabase(t)
+
+	old := time.Now().UTC().Add(-48 * time.Hour).Format(time.DateTime)
+	for _, text := range []string{"huis", "boom", "fiets"} {
+		if err := CacheTTS(ctx, db, text, "tts-1", "alloy", 1, []byte("mp3")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`UPDATE tts_cache SET created_at = ? WHERE text IN ('huis', 'boom')`, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO vocabulary (user_id, language, word) VALUES (1, 'Dutch', 'boom')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CleanOldCachedTTS(ctx, db, 24*time.Hour); err != nil {
+		t.Fatalf("CleanOldCachedTTS: %v", err)
+	}
+
+	for text, kept := range map[string]bool{"huis": false, "boom": true, "fiets": true} {
+		audio, err := GetCachedTTS(ctx, db, text, "tts-1", "alloy", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := audio != nil; got != kept {
+			t.Errorf("speech of %s kept = %v, want %v", text, got, kept)
+		}
+	}
+}
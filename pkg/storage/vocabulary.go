@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// VocabularyEntry is a word the user saved with its tags and, if the word was
+// looked up after responses became structured, its structured answer
+type VocabularyEntry struct {
+	ID         int
+	Word       string
+	Tags       []string
+	Structured string
+	AddedAt    time.Time
+}
+
+// VocabularyFilter narrows a vocabulary listing to words with the tag and
+// words or cached responses containing the search text
+type VocabularyFilter struct {
+	Tag    string
+	Search string
+}
+
+// SaveWord adds the word with the tags to the vocabulary of the user, linked
+// to the user's last lookup of it. Tags are added if the word was already
+// saved, in which case it reports false.
+func SaveWord(ctx context.Context, db *sql.DB, userID int, language, word string, tags []string) (bool, error) {
+	ctx, end := startQuery(ctx, "save_word")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO vocabulary (user_id, language, word, query_id)
+	VALUES (?1, ?2, ?3, (
+		SELECT id FROM queries
+		WHERE user_id = ?1 AND language = ?2 AND word = ?3 COLLATE NOCASE
+		ORDER BY id DESC LIMIT 1
+	))
+	ON CONFLICT(user_id, language, word) DO NOTHING;
+	`
+	result, err := tx.ExecContext(ctx, query, userID, language, word)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	var vocabularyID int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM vocabulary WHERE user_id = ? AND language = ? AND word = ?;",
+		userID, language, word).Scan(&vocabularyID)
+	if err != nil {
+		return false, err
+	}
+	for _, tag := range tags {
+		_, err = tx.ExecContext(ctx, "INSERT INTO vocabulary_tags (vocabulary_id, tag) VALUES (?, ?) ON CONFLICT DO NOTHING;", vocabularyID, tag)
+		if err != nil {
+			return false, err
+		}
+	}
+	return inserted > 0, tx.Commit()
+}
+
+// ForgetWord removes the word and its tags from the vocabulary of the user.
+// It reports false if the word was not saved.
+func ForgetWord(ctx context.Context, db *sql.DB, userID int, language, word string) (bool, error) {
+	ctx, end := startQuery(ctx, "forget_word")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	DELETE FROM vocabulary_tags WHERE vocabulary_id IN (
+		SELECT id FROM vocabulary WHERE user_id = ? AND language = ? AND word = ?
+	);`, userID, language, word)
+	if err != nil {
+		return false, err
+	}
+	result, err := tx.ExecContext(ctx, "DELETE FROM vocabulary WHERE user_id = ? AND language = ? AND word = ?;", userID, language, word)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, tx.Commit()
+}
+
+// TagWord adds and removes tags of a saved word. It reports false if the word
+// is not saved.
+func TagWord(ctx context.Context, db *sql.DB, userID int, language, word string, add, remove []string) (bool, error) {
+	ctx, end := startQuery(ctx, "tag_word")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var vocabularyID int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM vocabulary WHERE user_id = ? AND language = ? AND word = ?;",
+		userID, language, word).Scan(&vocabularyID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, tag := range add {
+		_, err = tx.ExecContext(ctx, "INSERT INTO vocabulary_tags (vocabulary_id, tag) VALUES (?, ?) ON CONFLICT DO NOTHING;", vocabularyID, tag)
+		if err != nil {
+			return false, err
+		}
+	}
+	for _, tag := range remove {
+		_, err = tx.ExecContext(ctx, "DELETE FROM vocabulary_tags WHERE vocabulary_id = ? AND tag = ?;", vocabularyID, tag)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// vocabularyFilterCondition matches the words of ?1 in ?2 with the tag ?3
+// and the search text ?4, escaped with escapeLike, either of which may be
+// empty
+const vocabularyFilterCondition = `
+	v.user_id = ?1 AND v.language = ?2
+	AND (?3 = '' OR EXISTS (SELECT 1 FROM vocabulary_tags t WHERE t.vocabulary_id = v.id AND t.tag = ?3))
+	AND (?4 = '' OR v.word LIKE '%' || ?4 || '%' ESCAPE '\' OR EXISTS (
+		SELECT 1 FROM queries q
+		JOIN response_cache cr ON cr.query_id = q.id
+		WHERE q.language = v.language AND q.word = v.word AND cr.response LIKE '%' || ?4 || '%' ESCAPE '\'
+	))
+`
+
+// likeEscaper escapes the wildcards of LIKE and the escape character itself
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike returns the text to be matched literally by LIKE ... ESCAPE '\'
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// GetVocabulary returns a page of the saved words of the user matching the
+// filter, most recently saved first, and the number of matching words
+func GetVocabulary(ctx context.Context, db *sql.DB, userID int, language string, filter VocabularyFilter, limit, offset int) ([]VocabularyEntry, int, error) {
+	ctx, end := startQuery(ctx, "get_vocabulary")
+	defer end()
+
+	var total int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM vocabulary v WHERE "+vocabularyFilterCondition+";",
+		userID, language, filter.Tag, escapeLike(filter.Search)).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+	SELECT v.id, v.word, v.added_at,
+		COALESCE((SELECT group_concat(t.tag, ' ') FROM vocabulary_tags t WHERE t.vocabulary_id = v.id), ''),
+		COALESCE((
+			SELECT sr.structured FROM queries q
+			JOIN structured_responses sr ON sr.query_id = q.id
+			WHERE q.language = v.language AND q.word = v.word
+			ORDER BY q.help_type = 'translation' DESC, q.id DESC
+			LIMIT 1
+		), '')
+	FROM vocabulary v
+	WHERE ` + vocabularyFilterCondition + `
+	ORDER BY v.added_at DESC, v.id DESC
+	LIMIT ?5 OFFSET ?6;
+	`
+	rows, err := db.QueryContext(ctx, query, userID, language, filter.Tag, escapeLike(filter.Search), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var entries []VocabularyEntry
+	for rows.Next() {
+		var entry VocabularyEntry
+		var tags string
+		if err := rows.Scan(&entry.ID, &entry.Word, &entry.AddedAt, &tags, &entry.Structured); err != nil {
+			return nil, 0, err
+		}
+		entry.Tags = strings.Fields(tags)
+		entries = append(entries, entry)
+	}
+	return entries, total, rows.Err()
+}
+
+// GetVocabularyTags returns the tags the user gave saved words in the language
+func GetVocabularyTags(ctx context.Context, db *sql.DB, userID int, language string) ([]string, error) {
+	ctx, end := startQuery(ctx, "get_vocabulary_tags")
+	defer end()
+
+	query := `
+	SELECT DISTINCT t.tag
+	FROM vocabulary_tags t
+	JOIN vocabulary v ON v.id = t.vocabulary_id
+	WHERE v.user_id = ? AND v.language = ?
+	ORDER BY t.tag;
+	`
+	rows, err := db.QueryContext(ctx, query, userID, language)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// VocabularyExport is a saved word with its cached translation and examples
+// and its cached pronunciation, each empty if there is none
+type VocabularyExport struct {
+	Language    string
+	Word        string
+	Tags        []string
+	Translation string
+	Examples    string
+	Audio       []byte
+	AddedAt     time.Time
+}
+
+// GetVocabularyExport returns every saved word of the user in the language,
+// or in all languages if language is empty, with its cached responses, oldest
+// first
+func GetVocabularyExport(ctx context.Context, db *sql.DB, userID int, language string) ([]VocabularyExport, error) {
+	ctx, end := startQuery(ctx, "get_vocabulary_export")
+	defer end()
+
+	query := `
+	SELECT v.language, v.word, v.added_at,
+		COALESCE((SELECT group_concat(t.tag, ' ') FROM vocabulary_tags t WHERE t.vocabulary_id = v.id), ''),
+		COALESCE((
+			SELECT cr.response FROM queries q
+			JOIN response_cache cr ON cr.query_id = q.id
+			WHERE q.language = v.language AND q.word = v.word AND q.help_type = 'translation'
+			ORDER BY q.id DESC LIMIT 1
+		), ''),
+		COALESCE((
+			SELECT cr.response FROM queries q
+			JOIN response_cache cr ON cr.query_id = q.id
+			WHERE q.language = v.language AND q.word = v.word AND q.help_type = 'examples'
+			ORDER BY q.id DESC LIMIT 1
+		), ''),
+		(SELECT tc.audio FROM tts_cache tc WHERE tc.text = v.word ORDER BY tc.created_at DESC LIMIT 1)
+	FROM vocabulary v
+	WHERE v.user_id = ?1 AND (?2 = '' OR v.language = ?2)
+	ORDER BY v.added_at, v.id;
+	`
+	rows, err := db.QueryContext(ctx, query, userID, language)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var words []VocabularyExport
+	for rows.Next() {
+		var word VocabularyExport
+		var tags string
+		if err := rows.Scan(&word.Language, &word.Word, &word.AddedAt, &tags, &word.Translation, &word.Examples, &word.Audio); err != nil {
+			return nil, err
+		}
+		word.Tags = strings.Fields(tags)
+		words = append(words, word)
+	}
+	return words, rows.Err()
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestGetVocabularySearchIsLiteral(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDatabase(t)
+
+	for _, word := range []string{"huis", "100%", "a_b", `a\b`} {
+		if _, err := SaveWord(ctx, db, 1, "Dutch", word, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"", []string{`a\b`, "a_b", "100%", "huis"}},
+		{"ui", []string{"huis"}},
+		{"%", []string{"100%"}},
+		{"_", []string{"a_b"}},
+		{`\`, []string{`a\b`}},
+		{"h_is", nil},
+	}
+	for _, tt := range tests {
+		entries, total, err := GetVocabulary(ctx, db, 1, "Dutch", VocabularyFilter{Search: tt.search}, 10, 0)
+		if err != nil {
+			t.Fatalf("GetVocabulary(%q): %v", tt.search, err)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.Word)
+		}
+		if total != len(tt.want) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search %q found %q (total %d), want %q", tt.search, got, total, tt.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+type WordOfDay struct {
+	ID       int
+	Language string
+	Word     string
+	Day      string
+}
+
+// WordOfDaySubscriber is a user the word of the day is due for
+type WordOfDaySubscriber struct {
+	UserID   int
+	Language string
+}
+
+// GetWordOfDay returns the word picked for the language on the day, or nil
+// if none was picked yet
+func GetWordOfDay(ctx context.Context, db *sql.DB, language, day string) (*WordOfDay, error) {
+	ctx, end := startQuery(ctx, "get_word_of_day")
+	defer end()
+
+	query := `
+	SELECT id, language, word, day
+	FROM words_of_day
+	WHERE language = ? AND day = ?;
+	`
+	var word WordOfDay
+	err := db.QueryRowContext(ctx, query, language, day).Scan(&word.ID, &word.Language, &word.Word, &word.Day)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &word, nil
+}
+
+// GetWordOfDayByID returns the word of the day with the ID, or nil if there is none
+func GetWordOfDayByID(ctx context.Context, db *sql.DB, id int) (*WordOfDay, error) {
+	ctx, end := startQuery(ctx, "get_word_of_day_by_id")
+	defer end()
+
+	query := `
+	SELECT id, language, word, day
+	FROM words_of_day
+	WHERE id = ?;
+	`
+	var word WordOfDay
+	err := db.QueryRowContext(ctx, query, id).Scan(&word.ID, &word.Language, &word.Word, &word.Day)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &word, nil
+}
+
+// GetPastWordsOfDay returns every word picked for the language, latest first
+func GetPastWordsOfDay(ctx context.Context, db *sql.DB, language string) ([]string, error) {
+	ctx, end := startQuery(ctx, "get_past_words_of_day")
+	defer end()
+
+	query := `
+	SELECT word
+	FROM words_of_day
+	WHERE language = ?
+	ORDER BY day DESC;
+	`
+	rows, err := db.QueryContext(ctx, query, language)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var words []string
+	for rows.Next() {
+		var word string
+		if err := rows.Scan(&word); err != nil {
+			return nil, err
+		}
+		words = append(words, word)
+	}
+	return words, rows.Err()
+}
+
+// StoreWordOfDay stores the word for the language on the day, keeping the
+// word already picked if there is one
+func StoreWordOfDay(ctx context.Context, db *sql.DB, language, day, word string) error {
+	ctx, end := startQuery(ctx, "store_word_of_day")
+	defer end()
+
+	query := `
+	INSERT INTO words_of_day (language, word, day)
+	VALUES (?, ?, ?)
+	ON CONFLICT(language, day) DO NOTHING;
+	`
+	_, err := db.ExecContext(ctx, query, language, word, day)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SubscribeWordOfDay subscribes the user to the word of the day at the UTC
+// time HH:MM, or changes the time of the subscription
+func SubscribeWordOfDay(ctx context.Context, db *sql.DB, userID int, deliveryTime string) error {
+	ctx, end := startQuery(ctx, "subscribe_word_of_day")
+	defer end()
+
+	query := `
+	INSERT INTO word_of_day_subscriptions (user_id, delivery_time)
+	VALUES (?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET delivery_time = EXCLUDED.delivery_time;
+	`
+	_, err := db.ExecContext(ctx, query, userID, deliveryTime)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UnsubscribeWordOfDay removes the subscription of the user
+func UnsubscribeWordOfDay(ctx context.Context, db *sql.DB, userID int) error {
+	ctx, end := startQuery(ctx, "unsubscribe_word_of_day")
+	defer end()
+
+	_, err := db.ExecContext(ctx, "DELETE FROM word_of_day_subscriptions WHERE user_id = ?;", userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetWordOfDaySubscription returns the delivery time of the user, or an empty
+// string if the user is not subscribed
+func GetWordOfDaySubscription(ctx context.Context, db *sql.DB, userID int) (string, error) {
+	ctx, end := startQuery(ctx, "get_word_of_day_subscription")
+	defer end()
+
+	var deliveryTime string
+	err := db.QueryRowContext(ctx, "SELECT delivery_time FROM word_of_day_subscriptions WHERE user_id = ?;", userID).Scan(&deliveryTime)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return deliveryTime, nil
+}
+
+// GetDueWordOfDaySubscribers returns the subscribers whose delivery time
+// passed on the day and who were not sent the word of the day yet, with their
+// current language
+func GetDueWordOfDaySubscribers(ctx context.Context, db *sql.DB, day, now string) ([]WordOfDaySubscriber, error) {
+	ctx, end := startQuery(ctx, "get_due_word_of_day_subscribers")
+	defer end()
+
+	query := `
+	SELECT s.user_id, u.language
+	FROM word_of_day_subscriptions s
+	JOIN users u ON u.id = s.user_id
+	WHERE s.delivery_time <= ?2 AND (s.last_sent_day IS NULL OR s.last_sent_day < ?1) AND u.language != '';
+	`
+	rows, err := db.QueryContext(ctx, query, day, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscribers []WordOfDaySubscriber
+	for rows.Next() {
+		var subscriber WordOfDaySubscriber
+		if err := rows.Scan(&subscriber.UserID, &subscriber.Language); err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	return subscribers, rows.Err()
+}
+
+// MarkWordOfDaySent records that the user was sent the word of the day
+func MarkWordOfDaySent(ctx context.Context, db *sql.DB, userID int, day string) error {
+	ctx, end := startQuery(ctx, "mark_word_of_day_sent")
+	defer end()
+
+	_, err := db.ExecContext(ctx, "UPDATE word_of_day_subscriptions SET last_sent_day = ? WHERE user_id = ?;", day, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
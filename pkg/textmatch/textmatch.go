@@ -0,0 +1,106 @@
+// Package textmatch compares answers typed by learners with the expected
+// ones, tolerating what is hard to type on a phone keyboard: case, accents,
+// stress marks and surrounding punctuation
+package textmatch
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+type Result int
+
+const (
+	// Wrong answers differ in more than case, accents and punctuation
+	Wrong Result = iota
+	// Typo answers are off by a letter or two, only returned by CompareFuzzy
+	Typo
+	// AccentsDiffer answers are right apart from accents or stress marks
+	AccentsDiffer
+	// Correct answers are equal to the expected one apart from case and punctuation
+	Correct
+)
+
+// Compare compares the answer with every expected alternative and returns
+// the best result
+func Compare(answer string, expected ...string) Result {
+	best := Wrong
+	for _, e := range expected {
+		switch {
+		case simplify(answer) == simplify(e):
+			return Correct
+		case Fold(answer) == Fold(e):
+			best = AccentsDiffer
+		}
+	}
+	return best
+}
+
+// CompareFuzzy is Compare that also tolerates small typos: one edit in words
+// of up to six letters and two edits in longer ones
+func CompareFuzzy(answer string, expected ...string) Result {
+	best := Compare(answer, expected...)
+	if best != Wrong {
+		return best
+	}
+	folded := Fold(answer)
+	for _, e := range expected {
+		e = Fold(e)
+		allowed := 1
+		if len([]rune(e)) > 6 {
+			allowed = 2
+		}
+		if Distance(folded, e) <= allowed {
+			return Typo
+		}
+	}
+	return Wrong
+}
+
+// Distance returns the Levenshtein distance between a and b in runes
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// Fold lower-cases s, removes diacritics and punctuation and collapses whitespace
+func Fold(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(simplify(s)) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return norm.NFC.String(b.String())
+}
+
+// Words returns the words of s lower-cased and without punctuation
+func Words(s string) []string {
+	return strings.Fields(simplify(s))
+}
+
+// simplify lower-cases s, removes punctuation and collapses whitespace
+func simplify(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(norm.NFC.String(s)), func(r rune) bool {
+		return unicode.IsSpace(r) || (unicode.IsPunct(r) && r != '\'' && r != '-')
+	})
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,114 @@
+package textmatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   string
+		expected []string
+		want     Result
+	}{
+		{"equal", "huis", []string{"huis"}, Correct},
+		{"case and punctuation", "Hello, world!", []string{"hello world"}, Correct},
+		{"whitespace", "  ik   ga ", []string{"ik ga"}, Correct},
+		{"missing accent", "ecole", []string{"école"}, AccentsDiffer},
+		{"stress mark", "молоко", []string{"моло́ко"}, AccentsDiffer},
+		{"yo folded to ye", "елка", []string{"ёлка"}, AccentsDiffer},
+		{"decomposed accent", "e\u0301cole", []string{"\u00e9cole"}, Correct},
+		{"apostrophe is kept", "leau", []string{"l'eau"}, Wrong},
+		{"hyphen is kept", "email", []string{"e-mail"}, Wrong},
+		{"best of the alternatives", "ga", []string{"gaat", "gá", "Ga."}, Correct},
+		{"accents of an alternative", "ga", []string{"gaat", "gá"}, AccentsDiffer},
+		{"typo is wrong", "hus", []string{"huis"}, Wrong},
+		{"no alternatives", "huis", nil, Wrong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compare(tt.answer, tt.expected...); got != tt.want {
+				t.Errorf("Compare(%q, %q) = %v, want %v", tt.answer, tt.expected, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareFuzzy(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   string
+		expected []string
+		want     Result
+	}{
+		{"correct wins", "Huis.", []string{"huis"}, Correct},
+		{"accents win over typos", "ecole", []string{"école"}, AccentsDiffer},
+		{"one edit in a short word", "hus", []string{"huis"}, Typo},
+		{"two edits in a short word", "hius", []string{"huis"}, Wrong},
+		{"one edit in a six letter word", "werkn", []string{"werken"}, Typo},
+		{"two edits in a six letter word", "wrkn", []string{"werken"}, Wrong},
+		{"two edits in a seven letter word", "sprkn", []string{"spreken"}, Typo},
+		{"three edits in a long word", "schrvn", []string{"schrijven"}, Wrong},
+		{"typo and missing accent", "ecol", []string{"école"}, Typo},
+		{"allowance by length in runes, not bytes", "малако", []string{"молоко"}, Wrong},
+		{"typo of an alternative", "gaan", []string{"lopen", "gaat"}, Typo},
+		{"empty answer", "", []string{"ja"}, Wrong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CompareFuzzy(tt.answer, tt.expected...); got != tt.want {
+				t.Errorf("CompareFuzzy(%q, %q) = %v, want %v", tt.answer, tt.expected, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"huis", "hius", 2},
+		{"ü", "u", 1},
+		{"молоко", "малако", 2},
+	}
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("Distance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := Distance(tt.b, tt.a); got != tt.want {
+			t.Errorf("Distance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{"Ça va?", "ca va"},
+		{"  Straße  ", "straße"},
+		{"MOLÓKO", "moloko"},
+		{"über-all", "uber-all"},
+		{"l'été", "l'ete"},
+		{"...", ""},
+	}
+	for _, tt := range tests {
+		if got := Fold(tt.s); got != tt.want {
+			t.Errorf("Fold(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestWords(t *testing.T) {
+	got := Words("Hello, World! It's  a well-known fact.")
+	want := []string{"hello", "world", "it's", "a", "well-known", "fact"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Words = %q, want %q", got, want)
+	}
+}
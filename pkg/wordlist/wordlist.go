@@ -0,0 +1,160 @@
+// Package wordlist reads lists of words with optional tags from CSV, TSV,
+// plain text and JSON files
+package wordlist
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Entry is a word of a list with its tags and, if the list names it, its
+// language
+type Entry struct {
+	Word     string   `json:"word"`
+	Tags     []string `json:"tags,omitempty"`
+	Language string   `json:"language,omitempty"`
+}
+
+// wordColumns, tagColumns and languageColumns are the header names of the
+// word, tags and language columns
+var (
+	wordColumns     = []string{"word", "term", "front", "phrase"}
+	tagColumns      = []string{"tags", "tag"}
+	languageColumns = []string{"language", "lang"}
+)
+
+// Parse reads the entries of a list, choosing the format by the extension of
+// name: .json for an array of words or of {"word", "tags"} objects, .csv for
+// comma or semicolon separated values and anything else for tab separated
+// values or a word per line. Separated values may start with a header row
+// naming the word, tags and language columns; otherwise the word is in the
+// first column and the tags in the second. Empty and repeated words are
+// skipped.
+func Parse(name string, content []byte) ([]Entry, error) {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+
+	var entries []Entry
+	var err error
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		entries, err = parseJSON(content)
+	case ".csv":
+		entries, err = parseSeparated(content, csvDelimiter(content))
+	default:
+		entries, err = parseSeparated(content, '\t')
+	}
+	if err != nil {
+		return nil, err
+	}
+	return normalize(entries), nil
+}
+
+func parseJSON(content []byte) ([]Entry, error) {
+	var words []string
+	if err := json.Unmarshal(content, &words); err == nil {
+		entries := make([]Entry, 0, len(words))
+		for _, word := range words {
+			entries = append(entries, Entry{Word: word})
+		}
+		return entries, nil
+	}
+	var entries []Entry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, errors.New("JSON must be an array of words or of objects with a word and tags")
+	}
+	return entries, nil
+}
+
+// csvDelimiter guesses semicolons, as spreadsheets in many locales write
+// them, if the first line has semicolons but no commas
+func csvDelimiter(content []byte) rune {
+	firstLine, _, _ := bytes.Cut(content, []byte("\n"))
+	if bytes.ContainsRune(firstLine, ';') && !bytes.ContainsRune(firstLine, ',') {
+		return ';'
+	}
+	return ','
+}
+
+func parseSeparated(content []byte, delimiter rune) ([]Entry, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading rows: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	wordColumn, tagColumn, languageColumn := 0, 1, -1
+	if header := records[0]; columnIndex(header, wordColumns) >= 0 {
+		wordColumn, tagColumn = columnIndex(header, wordColumns), columnIndex(header, tagColumns)
+		languageColumn = columnIndex(header, languageColumns)
+		records = records[1:]
+	}
+
+	entries := make([]Entry, 0, len(records))
+	for _, record := range records {
+		if wordColumn >= len(record) {
+			continue
+		}
+		entry := Entry{Word: record[wordColumn]}
+		if tagColumn >= 0 && tagColumn < len(record) {
+			entry.Tags = splitTags(record[tagColumn])
+		}
+		if languageColumn >= 0 && languageColumn < len(record) {
+			entry.Language = record[languageColumn]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func columnIndex(header []string, names []string) int {
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		for _, name := range names {
+			if column == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitTags splits a tags cell such as "#work travel" or "work, travel"
+func splitTags(cell string) []string {
+	return strings.FieldsFunc(cell, func(r rune) bool { return r == ' ' || r == ',' || r == ';' || r == '|' })
+}
+
+// normalize trims the words and languages, lower-cases the tags and drops
+// the # of tags, and skips empty and repeated words of a language
+func normalize(entries []Entry) []Entry {
+	normalized := make([]Entry, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		word, language := strings.TrimSpace(entry.Word), strings.TrimSpace(entry.Language)
+		key := strings.ToLower(language + "\x00" + word)
+		if word == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		var tags []string
+		for _, tag := range entry.Tags {
+			if tag = strings.ToLower(strings.TrimLeft(strings.TrimSpace(tag), "#")); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		normalized = append(normalized, Entry{Word: word, Tags: tags, Language: language})
+	}
+	return normalized
+}
@@ -0,0 +1,152 @@
+package wordlist
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []Entry
+	}{
+		{
+			name:    "word per line",
+			file:    "words.txt",
+			content: "huis\nboom\n\nfiets\n",
+			want:    []Entry{{Word: "huis"}, {Word: "boom"}, {Word: "fiets"}},
+		},
+		{
+			name:    "tab separated without header",
+			file:    "words.tsv",
+			content: "huis\t#home #Family\nboom\n",
+			want:    []Entry{{Word: "huis", Tags: []string{"home", "family"}}, {Word: "boom"}},
+		},
+		{
+			name:    "comma separated without header",
+			file:    "words.csv",
+			content: "huis,home\nboom,nature\n",
+			want:    []Entry{{Word: "huis", Tags: []string{"home"}}, {Word: "boom", Tags: []string{"nature"}}},
+		},
+		{
+			name:    "semicolons",
+			file:    "words.csv",
+			content: "word;tags\nhuis;home work\nde boom;nature\n",
+			want:    []Entry{{Word: "huis", Tags: []string{"home", "work"}}, {Word: "de boom", Tags: []string{"nature"}}},
+		},
+		{
+			name:    "commas win over semicolons on the first line",
+			file:    "words.csv",
+			content: "word,tags\n\"huis\",\"home;work\"\n",
+			want:    []Entry{{Word: "huis", Tags: []string{"home", "work"}}},
+		},
+		{
+			name:    "byte order mark",
+			file:    "words.csv",
+			content: "\xef\xbb\xbfword,tags\nhuis,home\n",
+			want:    []Entry{{Word: "huis", Tags: []string{"home"}}},
+		},
+		{
+			name:    "header in any case and order",
+			file:    "words.csv",
+			content: "Tags, Term,notes\nhome,huis,a house\n",
+			want:    []Entry{{Word: "huis", Tags: []string{"home"}}},
+		},
+		{
+			name:    "header without tags column",
+			file:    "words.csv",
+			content: "front,back\nhuis,house\n",
+			want:    []Entry{{Word: "huis"}},
+		},
+		{
+			name:    "language column of a vocabulary export",
+			file:    "vocabulary.csv",
+			content: "language,word,tags,translation,examples,added_at\nDutch,huis,home,house,,2024-01-01T00:00:00Z\nGerman,Haus,,house,,2024-01-01T00:00:00Z\n",
+			want:    []Entry{{Word: "huis", Tags: []string{"home"}, Language: "Dutch"}, {Word: "Haus", Language: "German"}},
+		},
+		{
+			name:    "repeated words are skipped per language",
+			file:    "words.csv",
+			content: "word,language\nhuis,Dutch\nHuis,Dutch\nhuis,Afrikaans\n huis ,\n",
+			want:    []Entry{{Word: "huis", Language: "Dutch"}, {Word: "huis", Language: "Afrikaans"}, {Word: "huis"}},
+		},
+		{
+			name:    "rows without the word column are skipped",
+			file:    "words.csv",
+			content: "tags,word\nhome\nnature,boom\n",
+			want:    []Entry{{Word: "boom", Tags: []string{"nature"}}},
+		},
+		{
+			name:    "stray quotes are kept",
+			file:    "words.txt",
+			content: "het \"grote\" huis\n",
+			want:    []Entry{{Word: `het "grote" huis`}},
+		},
+		{
+			name:    "JSON words",
+			file:    "words.json",
+			content: `["huis", " boom ", "", "huis"]`,
+			want:    []Entry{{Word: "huis"}, {Word: "boom"}},
+		},
+		{
+			name:    "JSON objects",
+			file:    "words.JSON",
+			content: `[{"word": "huis", "tags": ["#Home"], "language": "Dutch", "translation": "house"}, {"word": "boom"}]`,
+			want:    []Entry{{Word: "huis", Tags: []string{"home"}, Language: "Dutch"}, {Word: "boom"}},
+		},
+		{
+			name:    "empty file",
+			file:    "words.csv",
+			content: "",
+			want:    []Entry{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.file, []byte(tt.content))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"JSON object", "words.json", `{"word": "huis"}`},
+		{"invalid JSON", "words.json", `["huis"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.file, []byte(tt.content)); err == nil {
+				t.Errorf("Parse(%q) returned no error", tt.content)
+			}
+		})
+	}
+}
+
+func TestCSVDelimiter(t *testing.T) {
+	tests := []struct {
+		content string
+		want    rune
+	}{
+		{"huis;home\nboom,nature", ';'},
+		{"huis,home;work", ','},
+		{"huis\nboom;nature", ','},
+		{"", ','},
+	}
+	for _, tt := range tests {
+		if got := csvDelimiter([]byte(tt.content)); got != tt.want {
+			t.Errorf("csvDelimiter(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
@@ -35,10 +35,270 @@ DROP TABLE IF EXISTS temp_users; -- Drop the temporary table
 -- Add indexes to queries table
 CREATE INDEX IF NOT EXISTS idx_queries_language ON queries (language, help_type, word);
 
--- Cached Responses Table
+-- Cached Responses Table, replaced by the response cache table below, which
+-- records when responses were cached, and only kept to migrate it
 CREATE TABLE IF NOT EXISTS cached_responses (
     query_id INTEGER NOT NULL,
     response TEXT NOT NULL,
     FOREIGN KEY (query_id) REFERENCES queries(id)
 );
 
+-- Response Cache Table, the responses by the lookup they were generated for
+CREATE TABLE IF NOT EXISTS response_cache (
+    query_id INTEGER NOT NULL,
+    response TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (query_id) REFERENCES queries(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_response_cache_created_at ON response_cache (created_at);
+
+-- Move the cached responses, cached at the time of the lookup they were
+-- generated for, into the response cache
+INSERT INTO response_cache (query_id, response, created_at)
+SELECT cr.query_id, cr.response, q.timestamp
+FROM cached_responses cr
+JOIN queries q ON q.id = cr.query_id;
+DROP TABLE IF EXISTS cached_responses;
+
+
+-- Structured Responses Table, the JSON answer a cached response was rendered from
+CREATE TABLE IF NOT EXISTS structured_responses (
+    query_id INTEGER NOT NULL,
+    structured TEXT NOT NULL,
+    FOREIGN KEY (query_id) REFERENCES queries(id)
+);
+
+-- Chat Sessions Table, the conversation practice scenario and adapted difficulty per user and language
+CREATE TABLE IF NOT EXISTS chat_sessions (
+    user_id INTEGER NOT NULL,
+    language TEXT NOT NULL,
+    scenario TEXT NOT NULL,
+    difficulty INTEGER NOT NULL DEFAULT 0,
+    clean_turns INTEGER NOT NULL DEFAULT 0, -- messages without mistakes since the difficulty changed
+    mistake_turns INTEGER NOT NULL DEFAULT 0, -- messages with mistakes since the difficulty changed
+    PRIMARY KEY (user_id, language),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Chat Messages Table, the history of the current conversation per user and language
+CREATE TABLE IF NOT EXISTS chat_messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    language TEXT NOT NULL,
+    role TEXT NOT NULL,
+    content TEXT NOT NULL,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_user ON chat_messages (user_id, language, id);
+
+-- Corrections Table, texts written by users and their corrected versions
+CREATE TABLE IF NOT EXISTS corrections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    language TEXT NOT NULL,
+    original_text TEXT NOT NULL,
+    corrected_text TEXT NOT NULL,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Correction Items Table, the categorized mistakes fixed in a correction
+CREATE TABLE IF NOT EXISTS correction_items (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    correction_id INTEGER NOT NULL,
+    category TEXT NOT NULL,
+    original TEXT NOT NULL,
+    corrected TEXT NOT NULL,
+    explanation TEXT NOT NULL,
+    FOREIGN KEY (correction_id) REFERENCES corrections(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_corrections_user ON corrections (user_id, language);
+
+-- Mistakes Table, every mistake a user made in corrections, conversations and exercises
+CREATE TABLE IF NOT EXISTS mistakes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    language TEXT NOT NULL,
+    source TEXT NOT NULL, -- the mode the mistake was made in, e.g. correct or chat
+    source_id INTEGER, -- the row of the source table, e.g. correction_items(id)
+    category TEXT NOT NULL,
+    original TEXT NOT NULL,
+    corrected TEXT NOT NULL,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_mistakes_user ON mistakes (user_id, language, category);
+
+-- Record the mistakes of corrections made before the mistakes table existed
+INSERT INTO mistakes (user_id, language, source, source_id, category, original, corrected, timestamp)
+SELECT c.user_id, c.language, 'correct', ci.id, ci.category, ci.original, ci.corrected, c.timestamp
+FROM correction_items ci
+JOIN corrections c ON c.id = ci.correction_id
+WHERE NOT EXISTS (SELECT 1 FROM mistakes m WHERE m.source = 'correct' AND m.source_id = ci.id);
+
+-- Quizzes Table, the multiple-choice vocabulary quizzes taken by users and their score
+CREATE TABLE IF NOT EXISTS quizzes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    language TEXT NOT NULL,
+    score INTEGER, -- set when the last question is answered
+    started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    finished_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Quiz Questions Table
+CREATE TABLE IF NOT EXISTS quiz_questions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    quiz_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    word TEXT NOT NULL,
+    direction TEXT NOT NULL, -- to_meaning or to_word
+    prompt TEXT NOT NULL,
+    options TEXT NOT NULL, -- JSON array of the answer options
+    correct_option INTEGER NOT NULL,
+    chosen_option INTEGER,
+    answered_at DATETIME,
+    FOREIGN KEY (quiz_id) REFERENCES quizzes(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_quiz_questions_quiz ON quiz_questions (quiz_id, position);
+
+-- Exercises Table, drills and other exercises answered by typing, with the user's answer and score
+CREATE TABLE IF NOT EXISTS exercises (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    language TEXT NOT NULL,
+    kind TEXT NOT NULL, -- the mode of the exercise, e.g. drill
+    word TEXT NOT NULL, -- the word the exercise practices
+    prompt TEXT NOT NULL,
+    answer TEXT NOT NULL,
+    context TEXT NOT NULL DEFAULT '', -- shown with the result, e.g. the other forms of the word
+    user_answer TEXT,
+    score REAL, -- from 0 for wrong to 1 for correct
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    answered_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_exercises_user ON exercises (user_id, kind, answered_at);
+
+-- Words of the Day Table, one word per language and day, never repeated
+CREATE TABLE IF NOT EXISTS words_of_day (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    language TEXT NOT NULL,
+    word TEXT NOT NULL,
+    day TEXT NOT NULL, -- YYYY-MM-DD in UTC
+    UNIQUE (language, day),
+    UNIQUE (language, word)
+);
+
+-- Word of the Day Subscriptions Table
+CREATE TABLE IF NOT EXISTS word_of_day_subscriptions (
+    user_id INTEGER PRIMARY KEY,
+    delivery_time TEXT NOT NULL, -- HH:MM in UTC
+    last_sent_day TEXT, -- YYYY-MM-DD in UTC
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Vocabulary Table, the words the user saved, linked to the lookup they were saved from
+CREATE TABLE IF NOT EXISTS vocabulary (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    language TEXT NOT NULL,
+    word TEXT NOT NULL COLLATE NOCASE,
+    query_id INTEGER, -- the last lookup of the word by the user when it was saved
+    added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, language, word),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (query_id) REFERENCES queries(id)
+);
+
+-- Vocabulary Tags Table, e.g. work or travel
+CREATE TABLE IF NOT EXISTS vocabulary_tags (
+    vocabulary_id INTEGER NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (vocabulary_id, tag),
+    FOREIGN KEY (vocabulary_id) REFERENCES vocabulary(id)
+);
+
+-- TTS Cache Table, the generated speech of a text by voice settings
+CREATE TABLE IF NOT EXISTS tts_cache (
+    text TEXT NOT NULL,
+    model TEXT NOT NULL,
+    voice TEXT NOT NULL,
+    speed REAL NOT NULL,
+    audio BLOB NOT NULL, -- MP3
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (text, model, voice, speed)
+);
+
+-- User Levels Table, the CEFR level of a user per language, placed by the test or set by the user
+CREATE TABLE IF NOT EXISTS user_levels (
+    user_id INTEGER NOT NULL,
+    language TEXT NOT NULL,
+    level TEXT NOT NULL, -- A1 to C2
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, language),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Cached Response Levels Table, the CEFR level a cached response was written for; responses without one
+-- were written without a level and are only returned to users who have not set a level
+CREATE TABLE IF NOT EXISTS cached_response_levels (
+    query_id INTEGER PRIMARY KEY,
+    level TEXT NOT NULL,
+    FOREIGN KEY (query_id) REFERENCES queries(id)
+);
+
+-- Placement Tests Table, the adaptive tests placing users at a CEFR level
+CREATE TABLE IF NOT EXISTS placement_tests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    language TEXT NOT NULL,
+    previous_help_type TEXT NOT NULL, -- restored when the test is finished
+    level TEXT, -- set when the last question is answered
+    started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    finished_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Placement Questions Table, generated one at a time at the level the previous answers lead to
+CREATE TABLE IF NOT EXISTS placement_questions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    test_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    level TEXT NOT NULL, -- the CEFR level the question was written for
+    question TEXT NOT NULL,
+    options TEXT NOT NULL, -- JSON array of the answer options, empty for short answer questions
+    answer TEXT NOT NULL,
+    alternatives TEXT NOT NULL, -- JSON array of other accepted short answers
+    explanation TEXT NOT NULL,
+    user_answer TEXT,
+    correct INTEGER, -- 1 or 0, set when answered
+    answered_at DATETIME,
+    FOREIGN KEY (test_id) REFERENCES placement_tests(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_placement_questions_test ON placement_questions (test_id, position);
+
+-- User Languages Table, the languages a user learns with the mode and speech speed of each; users.language is the active one
+CREATE TABLE IF NOT EXISTS user_languages (
+    user_id INTEGER NOT NULL,
+    language TEXT NOT NULL,
+    help_type TEXT NOT NULL DEFAULT '',
+    speech_speed REAL NOT NULL DEFAULT 0.0,
+    added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, language),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Add the language of every user to their languages
+INSERT INTO user_languages (user_id, language, help_type, speech_speed)
+SELECT id, language, help_type, speech_speed FROM users WHERE true
+ON CONFLICT(user_id, language) DO NOTHING;